@@ -8,20 +8,24 @@ import (
 	lua "github.com/yuin/gopher-lua"
 )
 
-func Args(l *lua.LState, startIndex int, target any) error {
+// Args decodes the arguments of a Lua function call starting at startIndex into target, which must be a pointer to a
+// struct.
+// If the first argument is a table, it is converted to target using ToGo, otherwise the arguments are mapped to the
+// fields of target in order.
+func Args(l *lua.LState, startIndex int, target any, opts ...Option) error {
 	firstArg := l.Get(startIndex)
 	switch firstArg.Type() {
 	case lua.LTNil:
 		return nil
 	case lua.LTTable:
-		return ToGo(l, firstArg, target)
+		return ToGo(l, firstArg, target, opts...)
 	default:
 		// Process args sequentially
-		return sequentialArgs(l, startIndex, target)
+		return sequentialArgs(newDecoder(l, opts), startIndex, target)
 	}
 }
 
-func sequentialArgs(l *lua.LState, startIndex int, target any) error {
+func sequentialArgs(d *decoder, startIndex int, target any) error {
 	v := reflect.ValueOf(target)
 	if v.Kind() != reflect.Ptr {
 		return errors.New("target must be a pointer to a struct")
@@ -32,7 +36,7 @@ func sequentialArgs(l *lua.LState, startIndex int, target any) error {
 	}
 
 	for i := 0; i < v.NumField(); i++ {
-		if err := toGo(l, l.Get(startIndex+i), v.Field(i)); err != nil {
+		if err := d.decode(d.l.Get(startIndex+i), v.Field(i)); err != nil {
 			return fmt.Errorf("error processing arg #%d: %w", startIndex+i, err)
 		}
 	}
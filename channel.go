@@ -0,0 +1,233 @@
+package luax
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"unsafe"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Go channels are converted to and from Lua channels (lua.LChannel), which scripts use through the channel module of
+// gopher-lua (ch:receive(), ch:send(v), ch:close() and channel.select).
+//
+// Channels of lua.LValue are passed as is. Since Lua channels can only carry Lua values, channels of other element
+// types are bridged by a goroutine forwarding and converting the elements from one channel to the other, in the
+// direction given by the Go channel:
+//
+//   - converting a <-chan T or a chan T to Lua gives a channel receiving the elements sent by Go to the Go channel;
+//   - converting a chan<- T to Lua gives a channel whose elements sent by Lua are forwarded to the Go channel;
+//   - decoding a Lua channel to a <-chan T or a chan T gives a channel receiving the elements sent by Lua;
+//   - decoding a Lua channel to a chan<- T gives a channel whose elements sent by Go are forwarded to Lua.
+//
+// The forwarding goroutine stops, and closes its destination channel, when its source channel is closed. Converting
+// the same channel again in the same direction, while its forwarding goroutine runs, gives the same bridged channel,
+// so that elements are not shared between several goroutines. Bridged channels are unbuffered, buffering being left
+// to the original channel, so that no elements are left in a bridge once its goroutine stops.
+//
+// Elements are converted outside of the goroutine running the state, and must thus be plain data: registered types
+// are resolved when the channel is converted, tables are read without invoking metamethods, and elements holding
+// functions, channels, or implementing LuaValuer or FromLuaValuer cannot be converted. When an element cannot be
+// converted, the destination channel is closed right away, so that receivers do not miss elements unknowingly: the
+// failing element and the following ones are discarded until the source channel is closed, which keeps senders from
+// blocking.
+//
+// Since bridged channels are regular Lua channels, Lua can wait on events produced by goroutines with channel.select:
+//
+//	local events, errors = ctx.events, ctx.errors -- both converted from Go channels
+//	while true do
+//	  local case, value, ok = channel.select({"|<-", events}, {"|<-", errors})
+//	  if not ok then break end
+//	  if case == 1 then handle(value) else log(value) end
+//	end
+
+var luaValueType = reflect.TypeOf((*lua.LValue)(nil)).Elem()
+
+// bridges are the channels bridged for a state, while their forwarding goroutine runs.
+type bridges struct {
+	mu sync.Mutex
+	// toLua are the Lua channels bridged to Go channels, by Go channel and direction
+	toLua map[goChanKey]lua.LChannel
+	// toGo are the Go channels bridged to Lua channels, by Lua channel, element type and direction
+	toGo map[bridgeKey]reflect.Value
+}
+
+type goChanKey struct {
+	ch unsafe.Pointer
+	// toLua is set when elements are forwarded from the Go channel to the Lua channel
+	toLua bool
+}
+
+type bridgeKey struct {
+	ch   lua.LChannel
+	elem reflect.Type
+	// toLua is set when elements are forwarded from the Go channel to the Lua channel
+	toLua bool
+}
+
+// bridgesOf returns the bridges of l.
+func bridgesOf(l *lua.LState) *bridges {
+	reg := l.Get(lua.RegistryIndex)
+	if ud, ok := l.GetField(reg, "__luax_channels").(*lua.LUserData); ok {
+		return ud.Value.(*bridges)
+	}
+
+	b := &bridges{
+		toLua: make(map[goChanKey]lua.LChannel),
+		toGo:  make(map[bridgeKey]reflect.Value),
+	}
+	ud := l.NewUserData()
+	ud.Value = b
+	l.SetField(reg, "__luax_channels", ud)
+	return b
+}
+
+// chanToLua returns a Lua channel bridged to the Go channel rv.
+func (e *encoder) chanToLua(rv reflect.Value) lua.LChannel {
+	t := rv.Type()
+	if t.Elem() == luaValueType && t.ChanDir() == reflect.BothDir {
+		return rv.Convert(reflect.TypeOf(lua.LChannel(nil))).Interface().(lua.LChannel)
+	}
+
+	// Go channels which can be received from feed Lua, others are fed by Lua
+	toLua := t.ChanDir()&reflect.RecvDir != 0
+	b, key := bridgesOf(e.l), goChanKey{ch: rv.UnsafePointer(), toLua: toLua}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch, ok := b.toLua[key]; ok {
+		return ch
+	}
+
+	ch := make(chan lua.LValue)
+	b.toLua[key] = ch
+	release := func() {
+		b.mu.Lock()
+		delete(b.toLua, key)
+		b.mu.Unlock()
+	}
+	enc, dec := newForwarding(e.l, e.opts)
+	if toLua {
+		go forwardToLua(enc, rv, ch, release)
+	} else {
+		go forwardToGo(dec, ch, rv, release)
+	}
+	return ch
+}
+
+// chanToGo returns a Go channel of type t bridged to the Lua channel ch.
+func (d *decoder) chanToGo(ch lua.LChannel, t reflect.Type) reflect.Value {
+	if t.Elem() == luaValueType {
+		return reflect.ValueOf((chan lua.LValue)(ch)).Convert(t)
+	}
+
+	// Go channels which can only be sent to feed Lua, others are fed by Lua
+	toLua := t.ChanDir() == reflect.SendDir
+	b, key := bridgesOf(d.l), bridgeKey{ch: ch, elem: t.Elem(), toLua: toLua}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if goCh, ok := b.toGo[key]; ok {
+		return goCh.Convert(t)
+	}
+
+	goCh := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, t.Elem()), 0)
+	b.toGo[key] = goCh
+	release := func() {
+		b.mu.Lock()
+		delete(b.toGo, key)
+		b.mu.Unlock()
+	}
+	enc, dec := newForwarding(d.l, d.opts)
+	if toLua {
+		go forwardToLua(enc, goCh, ch, release)
+	} else {
+		go forwardToGo(dec, ch, goCh, release)
+	}
+	return goCh.Convert(t)
+}
+
+// newForwarding returns the encoder and decoder of a forwarding goroutine, detached from l which is used concurrently.
+// They use their own thread of l, and the types registered in l at the time of the call.
+func newForwarding(l *lua.LState, opts *options) (*encoder, *decoder) {
+	thread, _ := l.NewThread()
+	types := make(map[reflect.Type]*goTypeDescriptor)
+	for t, goType := range getGoTypesMap(l) {
+		types[t] = goType
+	}
+	return &encoder{l: thread, opts: opts, detached: true, types: types}, &decoder{l: thread, opts: opts, detached: true}
+}
+
+// errDetached returns the error of converting a value of type t outside of the goroutine running the state.
+func errDetached(t reflect.Type) error {
+	return fmt.Errorf("%v cannot be converted outside of the goroutine running the state", t)
+}
+
+// valueOrNil returns the lua.LValue held by elem, or nil if elem is a nil interface.
+func valueOrNil(elem reflect.Value) lua.LValue {
+	if v, ok := elem.Interface().(lua.LValue); ok {
+		return v
+	}
+	return lua.LNil
+}
+
+// forwardToLua sends the elements received from the Go channel src to the Lua channel dst until src is closed, and then
+// calls release. dst is closed early if an element cannot be converted.
+func forwardToLua(e *encoder, src reflect.Value, dst chan lua.LValue, release func()) {
+	defer release()
+	open := true
+	defer func() {
+		if open {
+			close(dst)
+		}
+	}()
+	for {
+		elem, ok := src.Recv()
+		if !ok {
+			return
+		}
+		if !open {
+			continue
+		}
+		if src.Type().Elem() == luaValueType {
+			dst <- valueOrNil(elem)
+			continue
+		}
+		enc := *e // Fresh conversion state for each element
+		v, err := enc.toLua(elem.Interface(), elem, elem.Type())
+		if err != nil {
+			close(dst)
+			open = false
+			continue
+		}
+		dst <- v
+	}
+}
+
+// forwardToGo sends the elements received from the Lua channel src to the Go channel dst until src is closed, and then
+// calls release. dst is closed early if an element cannot be converted.
+func forwardToGo(d *decoder, src chan lua.LValue, dst reflect.Value, release func()) {
+	defer release()
+	open := true
+	defer func() {
+		if open {
+			dst.Close()
+		}
+	}()
+	for v := range src {
+		if !open {
+			continue
+		}
+		if dst.Type().Elem() == luaValueType {
+			dst.Send(reflect.ValueOf(&v).Elem())
+			continue
+		}
+		elem := reflect.New(dst.Type().Elem()).Elem()
+		dec := *d // Fresh conversion state for each element
+		if err := dec.decode(v, elem); err != nil {
+			dst.Close()
+			open = false
+			continue
+		}
+		dst.Send(elem)
+	}
+}
@@ -0,0 +1,226 @@
+package luax
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type event struct {
+	Name  string `lua:"name"`
+	Value int    `lua:"value"`
+}
+
+func TestChannelsToLua(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+
+	// Go produces, Lua consumes
+	events := make(chan event)
+	errors := make(chan string, 1)
+	l.SetGlobal("events", ToLua(l, (<-chan event)(events)))
+	l.SetGlobal("errors", ToLua(l, errors))
+	go func() {
+		errors <- "oops"
+		for i := 1; i <= 3; i++ {
+			events <- event{Name: "e", Value: i}
+		}
+		close(events)
+	}()
+	require.NoError(l.DoString(`
+		sum, errs = 0, 0
+		while true do
+			local case, value, ok = channel.select({"|<-", events}, {"|<-", errors})
+			if case == 1 then
+				if not ok then break end
+				sum = sum + value.value
+			else
+				assert(value == "oops")
+				errs = errs + 1
+			end
+		end
+	`))
+	assert.Equal(lua.LNumber(6), l.GetGlobal("sum"))
+	assert.Equal(lua.LNumber(1), l.GetGlobal("errs"))
+
+	// Lua produces, Go consumes
+	names := make(chan string, 2)
+	l.SetGlobal("names", ToLua(l, (chan<- string)(names)))
+	require.NoError(l.DoString(`names:send("a"); names:send("b"); names:close()`))
+	var received []string
+	for name := range names {
+		received = append(received, name)
+	}
+	assert.Equal([]string{"a", "b"}, received)
+
+	// Channels of Lua values are passed as is
+	raw := make(chan lua.LValue)
+	assert.Equal(lua.LChannel(raw), ToLua(l, raw))
+	assert.Equal(lua.LNil, ToLua(l, (chan int)(nil)))
+}
+
+func TestChannelsToGo(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+
+	// Lua produces, Go consumes
+	// Metamethods are not invoked, and the channel is closed on the first element which cannot be converted
+	require.NoError(l.DoString(`
+		return { name = "a", value = 1 },
+			setmetatable({ name = "b" }, { __index = function() error("not raw") end }),
+			"invalid",
+			{ name = "c", value = 3 }
+	`))
+	ch := make(chan lua.LValue, 4)
+	for i := 1; i <= 4; i++ {
+		ch <- l.Get(i) // Tables with metatables cannot be sent from Lua
+	}
+	close(ch)
+	var events <-chan event
+	require.NoError(ToGo(l, lua.LChannel(ch), &events))
+	var received []event
+	for e := range events {
+		received = append(received, e)
+	}
+	assert.Equal([]event{{Name: "a", Value: 1}, {Name: "b"}}, received)
+
+	// Go produces, Lua consumes
+	require.NoError(l.DoString(`out = channel.make(); return out`))
+	var out chan<- int
+	require.NoError(ToGo(l, l.Get(-1), &out))
+	go func() {
+		out <- 42
+		close(out)
+	}()
+	require.NoError(l.DoString(`
+		local ok, v = out:receive()
+		assert(ok and v == 42)
+		ok, v = out:receive()
+		assert(not ok)
+	`))
+
+	// Channels of Lua values are passed as is
+	var raw <-chan lua.LValue
+	require.NoError(ToGo(l, l.GetGlobal("out"), &raw))
+	assert.Equal((<-chan lua.LValue)(l.GetGlobal("out").(lua.LChannel)), raw)
+
+	assert.EqualError(ToGo(l, lua.LString("x"), &raw), "type error: expected channel, got string")
+}
+
+type hub struct {
+	Events chan int `lua:"events"`
+	Hooks  chan any `lua:"hooks"`
+}
+
+func TestChannelBridgeReuse(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	RegisterType(l, "hub", (*hub)(nil))
+	h := &hub{Events: make(chan int), Hooks: make(chan any, 3)}
+	l.SetGlobal("hub", ToLua(l, h))
+	go func() {
+		for i := 1; i <= 5; i++ {
+			h.Events <- i
+		}
+		close(h.Events)
+	}()
+
+	// Each access to the field converts the channel again, and must receive from the same bridge
+	require.NoError(l.DoString(`
+		sum = 0
+		while true do
+			local ok, v = hub.events:receive()
+			if not ok then break end
+			sum = sum + v
+		end
+	`))
+	assert.Equal(lua.LNumber(15), l.GetGlobal("sum"))
+
+	// Elements needing the state cannot be converted by the forwarding goroutine, which closes the bridge
+	h.Hooks <- "a"
+	h.Hooks <- func() {}
+	h.Hooks <- "b"
+	close(h.Hooks)
+	require.NoError(l.DoString(`
+		hooks = {}
+		while true do
+			local ok, v = hub.hooks:receive()
+			if not ok then break end
+			table.insert(hooks, v)
+		end
+	`))
+	var hooks []string
+	require.NoError(ToGo(l, l.GetGlobal("hooks"), &hooks))
+	assert.Equal([]string{"a"}, hooks)
+}
+
+func TestChannelBridgeDirection(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`ch = channel.make(1)`))
+	ch := l.GetGlobal("ch")
+
+	// Bridges forwarding to Lua and to Go are distinct
+	var out chan<- int
+	var in <-chan int
+	require.NoError(ToGo(l, ch, &out))
+	require.NoError(ToGo(l, ch, &in))
+	assert.NotEqual(reflect.ValueOf(out).UnsafePointer(), reflect.ValueOf(in).UnsafePointer())
+
+	require.NoError(l.DoString(`ch:send(5)`))
+	select {
+	case v := <-in:
+		assert.Equal(5, v)
+	case <-time.After(time.Second):
+		t.Fatal("element not forwarded to Go")
+	}
+	close(out)
+
+	goCh := make(chan int)
+	assert.NotEqual(ToLua(l, (<-chan int)(goCh)), ToLua(l, (chan<- int)(goCh)))
+	close(goCh)
+}
+
+func TestChannelConcurrentRegistration(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	RegisterType(l, "money", (*money)(nil))
+	amounts := make(chan *money)
+	l.SetGlobal("amounts", ToLua(l, amounts))
+	go func() {
+		for i := 1; i <= 100; i++ {
+			amounts <- &money{Cents: i}
+		}
+		close(amounts)
+	}()
+
+	// The forwarding goroutine uses the types registered when the channel was converted, and does not read the state
+	for i := 0; i < 10; i++ {
+		RegisterType(l, fmt.Sprintf("conn%d", i), (*conn)(nil))
+		SetOptions(l, Strict())
+	}
+	require.NoError(l.DoString(`
+		total = 0
+		while true do
+			local ok, m = amounts:receive()
+			if not ok then break end
+			total = total + m.cents
+		end
+	`))
+	assert.Equal(lua.LNumber(5050), l.GetGlobal("total"))
+}
@@ -0,0 +1,6 @@
+// Package luax converts values between Go and gopher-lua, and exposes Go types, functions and modules to Lua.
+//
+// Proxies (see NewProxy and the proxy struct tag option) implement the __pairs and __ipairs metamethods, which the
+// pairs and ipairs functions of gopher-lua ignore. Scripts iterating over proxies need the versions set by
+// InstallPairs, which luax never installs on its own.
+package luax
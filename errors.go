@@ -0,0 +1,51 @@
+package luax
+
+import (
+	"reflect"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ConversionError is an error converting a Lua value to a Go value.
+type ConversionError struct {
+	// Path is the location of the value in the converted value (e.g. servers[3].port), or empty for the value itself
+	Path string
+	// Expected is the Go type the value was converted to, if known
+	Expected reflect.Type
+	// Actual is the Lua type of the value
+	Actual lua.LValueType
+	// Err is the cause of the error
+	Err error
+}
+
+func (e *ConversionError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// ConversionErrors are the errors of a conversion reporting several errors at once.
+// This happens in strict mode when there are unknown keys, or when the CollectErrors option is set.
+type ConversionErrors []*ConversionError
+
+func (e ConversionErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e ConversionErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,254 @@
+package luax
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// structField is a field of a struct as seen from Lua.
+type structField struct {
+	// index is the index sequence of the field, as used by reflect.Value.FieldByIndex
+	index []int
+	tag   luaStructTag
+}
+
+// structInfo is the cached conversion plan of a struct type.
+type structInfo struct {
+	// fields are the fields of the struct, in the order used for conversions
+	fields []structField
+	// byName indexes fields by Lua name
+	byName map[string]*structField
+	// byFoldedName indexes fields by lower case Lua name
+	byFoldedName map[string]*structField
+	// numericKeys is the field tagged with numkeys, if any
+	numericKeys *structField
+	// embedded are the embedded fields of the struct, at any depth
+	embedded []structField
+	// err reports an invalid field tag, which makes conversions fail
+	err error
+}
+
+type structInfoKey struct {
+	t       reflect.Type
+	naming  fieldNaming
+	promote bool
+}
+
+// structInfoCache maps struct types and naming options to their *structInfo.
+var structInfoCache sync.Map
+
+// cachedStructInfo returns the conversion plan of the struct type t, computing it on first use.
+// If promote is true, the fields of embedded structs are promoted (see structFields).
+func cachedStructInfo(t reflect.Type, naming fieldNaming, promote bool) *structInfo {
+	key := structInfoKey{t: t, naming: naming, promote: promote}
+	if info, ok := structInfoCache.Load(key); ok {
+		return info.(*structInfo)
+	}
+
+	fields := structFields(t, naming, promote)
+	info := &structInfo{
+		fields:       fields,
+		byName:       make(map[string]*structField, len(fields)),
+		byFoldedName: make(map[string]*structField, len(fields)),
+		embedded:     embeddedFields(t),
+	}
+	for i := range fields {
+		f := &fields[i]
+		if f.tag.Inline && info.err == nil {
+			// Inline structs are flattened by structFields, so this is not a struct
+			info.err = fmt.Errorf("field %s: inline is only allowed on structs", t.FieldByIndex(f.index).Name)
+		}
+		if f.tag.NumericKeys {
+			if info.numericKeys == nil {
+				info.numericKeys = f
+			}
+		} else {
+			info.byName[f.tag.FieldName] = f
+			info.byFoldedName[strings.ToLower(f.tag.FieldName)] = f
+		}
+	}
+
+	res, _ := structInfoCache.LoadOrStore(key, info)
+	return res.(*structInfo)
+}
+
+// structFields returns the fields of the struct type t as seen from Lua.
+// Fields of structs tagged with inline, and if promote is true fields of embedded structs without an explicit Lua
+// name, are promoted the way Go does it: a shallower field hides deeper fields with the same name, and conflicting
+// fields at the same depth are all dropped.
+// Promotion of embedded structs is used for userdata, so that promoted fields are accessible as in Go, but not for
+// conversions, where embedded structs are converted as a regular field named after their type.
+func structFields(t reflect.Type, naming fieldNaming, promote bool) []structField {
+	type candidate struct {
+		structField
+		depth int
+	}
+
+	var (
+		candidates []candidate
+		visited    = map[reflect.Type]bool{}
+		walk       func(t reflect.Type, index []int)
+	)
+	walk = func(t reflect.Type, index []int) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		defer delete(visited, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := luaStructTagOf(f, naming)
+			if tag.Ignore {
+				continue
+			}
+			fieldIndex := append(append([]int(nil), index...), i)
+
+			if ft := indirectType(f.Type); ft.Kind() == reflect.Struct {
+				if (promote && f.Anonymous && !tag.Named) || tag.Inline {
+					walk(ft, fieldIndex)
+					continue
+				}
+			}
+
+			if f.IsExported() {
+				candidates = append(candidates, candidate{
+					structField: structField{index: fieldIndex, tag: tag},
+					depth:       len(index),
+				})
+			}
+		}
+	}
+	walk(t, nil)
+
+	// Find the dominant field for each name
+	type dominant struct {
+		pos      int
+		depth    int
+		conflict bool
+	}
+	byName := make(map[string]*dominant)
+	for i, c := range candidates {
+		if c.tag.NumericKeys {
+			continue
+		}
+		d, ok := byName[c.tag.FieldName]
+		switch {
+		case !ok || c.depth < d.depth:
+			byName[c.tag.FieldName] = &dominant{pos: i, depth: c.depth}
+		case c.depth == d.depth:
+			d.conflict = true
+		}
+	}
+
+	fields := make([]structField, 0, len(candidates))
+	for i, c := range candidates {
+		if !c.tag.NumericKeys {
+			if d := byName[c.tag.FieldName]; d.pos != i || d.conflict {
+				continue
+			}
+		}
+		fields = append(fields, c.structField)
+	}
+	return fields
+}
+
+// embeddedFields returns the index sequences and types of the embedded fields of the struct type t, shallowest first.
+func embeddedFields(t reflect.Type) []structField {
+	var res []structField
+	queue := []structField{{}}
+	visited := map[reflect.Type]bool{}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		st := t
+		if len(cur.index) > 0 {
+			st = indirectType(t.FieldByIndex(cur.index).Type)
+		}
+		if visited[st] {
+			continue
+		}
+		visited[st] = true
+
+		for i := 0; i < st.NumField(); i++ {
+			f := st.Field(i)
+			if f.Anonymous && indirectType(f.Type).Kind() == reflect.Struct {
+				embedded := structField{index: append(append([]int(nil), cur.index...), i)}
+				res = append(res, embedded)
+				queue = append(queue, embedded)
+			}
+		}
+	}
+	return res
+}
+
+// fieldByIndex returns the nested field of v at index.
+// If alloc is true, nil embedded pointers are allocated along the way, otherwise an invalid value is returned when a
+// nil pointer is reached.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+// recursiveTypes caches the results of recursiveType.
+var recursiveTypes sync.Map
+
+// recursiveType returns whether values of type t can hold other values of type t, through pointers, slices, maps or
+// fields. Interfaces are not followed, as they are decoded to values built by toGoAny.
+func recursiveType(t reflect.Type) bool {
+	if res, ok := recursiveTypes.Load(t); ok {
+		return res.(bool)
+	}
+	res := holdsType(t, t, make(map[reflect.Type]bool))
+	recursiveTypes.Store(t, res)
+	return res
+}
+
+// holdsType returns whether values of type t can hold values of type target. seen are the types already searched.
+func holdsType(t, target reflect.Type, seen map[reflect.Type]bool) bool {
+	var inner []reflect.Type
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		inner = []reflect.Type{t.Elem()}
+	case reflect.Map:
+		inner = []reflect.Type{t.Key(), t.Elem()}
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			inner = append(inner, t.Field(i).Type)
+		}
+	}
+
+	for _, it := range inner {
+		if it == target {
+			return true
+		}
+		if !seen[it] {
+			seen[it] = true
+			if holdsType(it, target, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package luax
+
+import (
+	"fmt"
+	"reflect"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// FuncOption configures how a Go function is exposed to Lua.
+type FuncOption func(*funcOptions)
+
+type funcOptions struct {
+	returnErrors bool
+}
+
+// ReturnErrors makes a non-nil error result be returned to Lua as nil followed by the error message,
+// instead of raising a Lua error.
+func ReturnErrors() FuncOption {
+	return func(o *funcOptions) {
+		o.returnErrors = true
+	}
+}
+
+func newFuncOptions(opts []FuncOption) funcOptions {
+	var o funcOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// newGoFunction returns a Lua function calling the Go function f.
+// f is validated and an error is returned if it is not a function.
+func newGoFunction(f any, opts ...FuncOption) (lua.LGFunction, error) {
+	rf := reflect.ValueOf(f)
+	if rf.Kind() != reflect.Func {
+		return nil, fmt.Errorf("invalid type: expected function, got %T", f)
+	}
+	t := rf.Type()
+	o := newFuncOptions(opts)
+
+	return func(l *lua.LState) int {
+		return callGo(l, rf, goArgs(l, t, 0, 1), o)
+	}, nil
+}
+
+// goArgs decodes the Lua arguments starting at startIndex into values suitable to call a function of type t.
+// The first skip parameters of t are not decoded and are left to the caller.
+func goArgs(l *lua.LState, t reflect.Type, skip, startIndex int) []reflect.Value {
+	numIn := t.NumIn()
+	fixed := numIn
+	if t.IsVariadic() {
+		fixed--
+	}
+
+	args := make([]reflect.Value, numIn)
+	index := startIndex
+	for i := skip; i < fixed; i++ {
+		args[i] = goArg(l, index, t.In(i))
+		index++
+	}
+
+	if t.IsVariadic() {
+		sliceType := t.In(numIn - 1)
+		count := l.GetTop() - index + 1
+		if count < 0 {
+			count = 0
+		}
+		variadic := reflect.MakeSlice(sliceType, count, count)
+		for i := 0; i < count; i++ {
+			variadic.Index(i).Set(goArg(l, index+i, sliceType.Elem()))
+		}
+		args[numIn-1] = variadic
+	}
+	return args
+}
+
+// goArg decodes the Lua argument at index into a new value of type t.
+// Errors are raised as Lua argument errors.
+func goArg(l *lua.LState, index int, t reflect.Type) reflect.Value {
+	arg := reflect.New(t).Elem()
+	v := l.Get(index)
+	if v == lua.LNil && isNillable(t.Kind()) {
+		return arg
+	}
+	if err := toGo(l, v, arg); err != nil {
+		l.ArgError(index, err.Error())
+	}
+	return arg
+}
+
+func isNillable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return true
+	}
+	return false
+}
+
+// callGo calls f with args and pushes its results onto the stack.
+// If the last result of f is an error, it is not pushed, and a Lua error is raised when it is not nil
+// (or nil and the error message are returned if the ReturnErrors option is set).
+func callGo(l *lua.LState, f reflect.Value, args []reflect.Value, o funcOptions) int {
+	var results []reflect.Value
+	if f.Type().IsVariadic() {
+		results = f.CallSlice(args)
+	} else {
+		results = f.Call(args)
+	}
+
+	if n := len(results); n > 0 && f.Type().Out(n-1) == errorType {
+		if err, _ := results[n-1].Interface().(error); err != nil {
+			if o.returnErrors {
+				l.Push(lua.LNil)
+				l.Push(lua.LString(err.Error()))
+				return 2
+			}
+			l.RaiseError(err.Error())
+		}
+		results = results[:n-1]
+	}
+
+	for _, res := range results {
+		l.Push(ToLua(l, res.Interface()))
+	}
+	return len(results)
+}
+
+// newLuaFunction returns a Go function of type t calling the Lua function fn.
+// Arguments are converted with ToLua, and the values returned by fn are decoded into the results of t, missing values
+// leaving results to their zero value. If the last result of t is an error, it holds the Lua errors raised by fn and
+// the conversion errors; otherwise such errors cause a panic.
+// The returned function must be called from the goroutine running l.
+func newLuaFunction(l *lua.LState, fn *lua.LFunction, t reflect.Type) reflect.Value {
+	numOut := t.NumOut()
+	returnsError := numOut > 0 && t.Out(numOut-1) == errorType
+	if returnsError {
+		numOut--
+	}
+
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		results := make([]reflect.Value, t.NumOut())
+		for i := range results {
+			results[i] = reflect.New(t.Out(i)).Elem()
+		}
+
+		if t.IsVariadic() {
+			variadic := args[len(args)-1]
+			args = args[: len(args)-1 : len(args)-1]
+			for i := 0; i < variadic.Len(); i++ {
+				args = append(args, variadic.Index(i))
+			}
+		}
+		if err := callLua(l, fn, args, results[:numOut]); err != nil {
+			if !returnsError {
+				panic(err)
+			}
+			results[numOut].Set(reflect.ValueOf(err))
+		}
+		return results
+	})
+}
+
+// callLua calls the Lua function fn with args, and decodes the values it returns into results.
+func callLua(l *lua.LState, fn lua.LValue, args []reflect.Value, results []reflect.Value) error {
+	top := l.GetTop()
+	defer l.SetTop(top)
+
+	if _, err := pcall(l, fn, args); err != nil {
+		return err
+	}
+	return decodeResults(l, top+1, results)
+}
+
+// pcall calls fn with args, converted with ToLua, in protected mode.
+// It returns the number of values returned by fn, which are left on the stack.
+func pcall(l *lua.LState, fn lua.LValue, args []reflect.Value) (int, error) {
+	top := l.GetTop()
+	l.Push(fn)
+	e := newEncoder(l, nil)
+	for i, arg := range args {
+		v, err := e.toLua(arg.Interface(), arg, arg.Type())
+		if err != nil {
+			return 0, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		l.Push(v)
+	}
+	if err := l.PCall(len(args), lua.MultRet, nil); err != nil {
+		return 0, err
+	}
+	return l.GetTop() - top, nil
+}
+
+// decodeResults decodes the values of the stack starting at index into results.
+// Missing and nil values leave results to their zero value.
+func decodeResults(l *lua.LState, index int, results []reflect.Value) error {
+	for i, res := range results {
+		v := l.Get(index + i)
+		if v == lua.LNil {
+			continue
+		}
+		if err := toGo(l, v, res); err != nil {
+			return fmt.Errorf("result %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Call calls the Lua function fn with args, converted with ToLua, and decodes its first result into an R.
+// If R is a struct and fn returns several values, they are decoded into the exported fields of R in order instead,
+// skipping fields tagged with lua:"-". Returning more values than R has such fields is an error.
+// Lua errors raised by fn are returned as *lua.ApiError.
+func Call[R any](l *lua.LState, fn lua.LValue, args ...any) (R, error) {
+	var res R
+	top := l.GetTop()
+	defer l.SetTop(top)
+
+	values := make([]reflect.Value, len(args))
+	for i := range args {
+		values[i] = reflect.ValueOf(&args[i]).Elem()
+	}
+	n, err := pcall(l, fn, values)
+	if err != nil {
+		return res, err
+	}
+
+	rv := reflect.ValueOf(&res).Elem()
+	results := []reflect.Value{rv}
+	if rv.Kind() == reflect.Struct && n > 1 {
+		results = results[:0]
+		for i := 0; i < rv.NumField(); i++ {
+			f := rv.Type().Field(i)
+			if f.IsExported() && !luaStructTagOf(f, fieldNaming{}).Ignore {
+				results = append(results, rv.Field(i))
+			}
+		}
+		if n > len(results) {
+			return res, fmt.Errorf("%d results for %d fields of %v", n, len(results), rv.Type())
+		}
+	}
+	return res, decodeResults(l, top+1, results)
+}
+
+// receiverOf returns v as a value assignable to t.
+// Pointers are dereferenced if t is not a pointer type.
+func receiverOf(v any, t reflect.Type) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return rv, fmt.Errorf("%v expected - got nil", t)
+	}
+	if rv.Type().AssignableTo(t) {
+		return rv, nil
+	}
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() && rv.Type().Elem().AssignableTo(t) {
+		return rv.Elem(), nil
+	}
+	return rv, fmt.Errorf("%v expected - got %T", t, v)
+}
@@ -0,0 +1,169 @@
+package luax
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type hooks struct {
+	OnError  func(err string)                    `lua:"on_error"`
+	Parse    func(s string) (int, error)         `lua:"parse"`
+	Sum      func(values ...int) int             `lua:"sum"`
+	Describe func(it item, tags []string) string `lua:"describe"`
+	Missing  func()                              `lua:"missing"`
+}
+
+func TestLuaFunctions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`
+		errors = {}
+		return {
+			on_error = function(err) table.insert(errors, err) end,
+			parse = function(s)
+				local n = tonumber(s)
+				if not n then error("not a number: " .. s, 0) end
+				return n
+			end,
+			sum = function(...)
+				local sum = 0
+				for _, v in ipairs({...}) do sum = sum + v end
+				return sum
+			end,
+			describe = function(it, tags) return it.name .. "=" .. it.count .. " " .. table.concat(tags, ",") end,
+		}
+	`))
+
+	var h hooks
+	require.NoError(ToGo(l, l.Get(-1), &h))
+	top := l.GetTop()
+	assert.Nil(h.Missing)
+
+	h.OnError("boom")
+	errors := l.GetGlobal("errors").(*lua.LTable)
+	assert.Equal(1, errors.Len())
+	assert.Equal(lua.LString("boom"), errors.RawGetInt(1))
+
+	n, err := h.Parse("42")
+	assert.NoError(err)
+	assert.Equal(42, n)
+
+	_, err = h.Parse("x")
+	assert.ErrorContains(err, "not a number: x")
+
+	assert.Equal(6, h.Sum(1, 2, 3))
+	assert.Equal(0, h.Sum())
+	assert.Equal("a=2 x,y", h.Describe(item{Name: "a", Count: 2}, []string{"x", "y"}))
+	assert.Equal(top, l.GetTop())
+
+	// Errors panic without an error result
+	require.NoError(l.DoString(`return function() return "x" end`))
+	var f func() int
+	require.NoError(ToGo(l, l.Get(-1), &f))
+	assert.PanicsWithError("result 1: type error: expected number, got string", func() { f() })
+
+	assert.EqualError(ToGo(l, lua.LString("x"), &f), "type error: expected function, got string")
+}
+
+type scriptContext struct {
+	User    string                        `lua:"user"`
+	Upper   func(string) string           `lua:"upper"`
+	Lookup  func(key string) (int, error) `lua:"lookup"`
+	Helpers map[string]func(int, int) int `lua:"helpers"`
+	None    func()                        `lua:"none"`
+}
+
+func TestGoFunctionsToLua(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	l.SetGlobal("ctx", ToLua(l, scriptContext{
+		User:  "bob",
+		Upper: strings.ToUpper,
+		Lookup: func(key string) (int, error) {
+			if key != "answer" {
+				return 0, fmt.Errorf("unknown key %s", key)
+			}
+			return 42, nil
+		},
+		Helpers: map[string]func(int, int) int{
+			"add": func(a, b int) int { return a + b },
+		},
+	}))
+
+	require.NoError(l.DoString(`
+		assert(ctx.upper(ctx.user) == "BOB")
+		assert(ctx.lookup("answer") == 42)
+		assert(ctx.helpers.add(1, 2) == 3)
+		assert(ctx.none == nil)
+	`))
+
+	err := l.DoString(`ctx.lookup("question")`)
+	require.Error(err)
+	assert.Contains(err.Error(), "unknown key question")
+}
+
+type divResult struct {
+	Label     string `lua:"-"`
+	Quotient  int
+	Remainder int
+}
+
+func TestGenericHelpers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`
+		function greet(name, opts) return opts.greeting .. ", " .. name .. "!" end
+		function divmod(a, b) return math.floor(a / b), a % b end
+		function item(name) return { name = name, count = 3 } end
+		function fail() error("boom", 0) end
+	`))
+
+	s, err := Call[string](l, l.GetGlobal("greet"), "bob", map[string]string{"greeting": "Hello"})
+	assert.NoError(err)
+	assert.Equal("Hello, bob!", s)
+
+	d, err := Call[divResult](l, l.GetGlobal("divmod"), 7, 2)
+	assert.NoError(err)
+	assert.Equal(divResult{Quotient: 3, Remainder: 1}, d)
+
+	_, err = Call[struct{ Quotient int }](l, l.GetGlobal("divmod"), 7, 2)
+	assert.EqualError(err, "2 results for 1 fields of struct { Quotient int }")
+
+	_, err = Call[time.Time](l, l.GetGlobal("divmod"), 7, 2)
+	assert.EqualError(err, "2 results for 0 fields of time.Time")
+
+	it, err := Call[item](l, l.GetGlobal("item"), "x")
+	assert.NoError(err)
+	assert.Equal(item{Name: "x", Count: 3}, it)
+
+	_, err = Call[any](l, l.GetGlobal("fail"))
+	var apiErr *lua.ApiError
+	if assert.ErrorAs(err, &apiErr) {
+		assert.Equal(lua.LString("boom"), apiErr.Object)
+	}
+
+	_, err = Call[int](l, l.GetGlobal("greet"), "bob", map[string]string{"greeting": "Hi"})
+	assert.EqualError(err, "result 1: type error: expected number, got string")
+	assert.Equal(0, l.GetTop())
+
+	Push(l, 42, "x", item{Name: "y"})
+	require.Equal(3, l.GetTop())
+	n, err := Get[int](l, l.Get(1))
+	assert.NoError(err)
+	assert.Equal(42, n)
+	pushed, err := Get[item](l, l.Get(3))
+	assert.NoError(err)
+	assert.Equal(item{Name: "y"}, pushed)
+}
@@ -0,0 +1,142 @@
+package luax
+
+import (
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// The following interfaces can be implemented by registered types to provide the corresponding metamethods.
+// Binary metamethods receive the stack indexes of both operands; the receiver is the operand holding the Go value,
+// which may be either of them.
+// Methods returning an int push their results onto the stack and return the number of pushed values.
+// Additionally, types implementing fmt.Stringer get a __tostring metamethod.
+
+// LuaEqualer provides the __eq metamethod.
+type LuaEqualer interface {
+	LuaEqual(l *lua.LState, lhs, rhs int) bool
+}
+
+// LuaLessThan provides the __lt metamethod.
+type LuaLessThan interface {
+	LuaLessThan(l *lua.LState, lhs, rhs int) bool
+}
+
+// LuaLessEqual provides the __le metamethod.
+type LuaLessEqual interface {
+	LuaLessEqual(l *lua.LState, lhs, rhs int) bool
+}
+
+// LuaLengther provides the __len metamethod.
+type LuaLengther interface {
+	LuaLen(l *lua.LState) int
+}
+
+// LuaCaller provides the __call metamethod. Call arguments start at index 2.
+type LuaCaller interface {
+	LuaCall(l *lua.LState) int
+}
+
+// LuaConcatenator provides the __concat metamethod.
+type LuaConcatenator interface {
+	LuaConcat(l *lua.LState, lhs, rhs int) int
+}
+
+// LuaAdder provides the __add metamethod.
+type LuaAdder interface {
+	LuaAdd(l *lua.LState, lhs, rhs int) int
+}
+
+// LuaSubtracter provides the __sub metamethod.
+type LuaSubtracter interface {
+	LuaSub(l *lua.LState, lhs, rhs int) int
+}
+
+// LuaMultiplier provides the __mul metamethod.
+type LuaMultiplier interface {
+	LuaMul(l *lua.LState, lhs, rhs int) int
+}
+
+// LuaDivider provides the __div metamethod.
+type LuaDivider interface {
+	LuaDiv(l *lua.LState, lhs, rhs int) int
+}
+
+// LuaModuloer provides the __mod metamethod.
+type LuaModuloer interface {
+	LuaMod(l *lua.LState, lhs, rhs int) int
+}
+
+// LuaPowerer provides the __pow metamethod.
+type LuaPowerer interface {
+	LuaPow(l *lua.LState, lhs, rhs int) int
+}
+
+// LuaNegater provides the __unm metamethod.
+type LuaNegater interface {
+	LuaUnm(l *lua.LState) int
+}
+
+// addMetamethods adds to funcs the metamethods implemented by v.
+// Metamethods already present in funcs (i.e. explicitly registered as methods) are left untouched.
+func addMetamethods(v any, funcs map[string]lua.LGFunction) {
+	if _, ok := v.(fmt.Stringer); ok && funcs["__tostring"] == nil {
+		funcs["__tostring"] = func(l *lua.LState) int {
+			l.Push(lua.LString(CheckUserData[fmt.Stringer](l, 1).String()))
+			return 1
+		}
+	}
+
+	setBoolMetamethod(v, funcs, "__eq", LuaEqualer.LuaEqual)
+	setBoolMetamethod(v, funcs, "__lt", LuaLessThan.LuaLessThan)
+	setBoolMetamethod(v, funcs, "__le", LuaLessEqual.LuaLessEqual)
+	setUnaryMetamethod(v, funcs, "__len", LuaLengther.LuaLen)
+	setUnaryMetamethod(v, funcs, "__call", LuaCaller.LuaCall)
+	setUnaryMetamethod(v, funcs, "__unm", LuaNegater.LuaUnm)
+	setBinaryMetamethod(v, funcs, "__concat", LuaConcatenator.LuaConcat)
+	setBinaryMetamethod(v, funcs, "__add", LuaAdder.LuaAdd)
+	setBinaryMetamethod(v, funcs, "__sub", LuaSubtracter.LuaSub)
+	setBinaryMetamethod(v, funcs, "__mul", LuaMultiplier.LuaMul)
+	setBinaryMetamethod(v, funcs, "__div", LuaDivider.LuaDiv)
+	setBinaryMetamethod(v, funcs, "__mod", LuaModuloer.LuaMod)
+	setBinaryMetamethod(v, funcs, "__pow", LuaPowerer.LuaPow)
+}
+
+func setUnaryMetamethod[T any](v any, funcs map[string]lua.LGFunction, name string, f func(T, *lua.LState) int) {
+	if _, ok := v.(T); ok && funcs[name] == nil {
+		funcs[name] = func(l *lua.LState) int {
+			return f(CheckUserData[T](l, 1), l)
+		}
+	}
+}
+
+func setBinaryMetamethod[T any](v any, funcs map[string]lua.LGFunction, name string,
+	f func(T, *lua.LState, int, int) int) {
+	if _, ok := v.(T); ok && funcs[name] == nil {
+		funcs[name] = func(l *lua.LState) int {
+			return f(binaryReceiver[T](l), l, 1, 2)
+		}
+	}
+}
+
+func setBoolMetamethod[T any](v any, funcs map[string]lua.LGFunction, name string,
+	f func(T, *lua.LState, int, int) bool) {
+	if _, ok := v.(T); ok && funcs[name] == nil {
+		funcs[name] = func(l *lua.LState) int {
+			l.Push(lua.LBool(f(binaryReceiver[T](l), l, 1, 2)))
+			return 1
+		}
+	}
+}
+
+// binaryReceiver returns the operand of a binary metamethod holding a T.
+func binaryReceiver[T any](l *lua.LState) T {
+	for i := 1; i <= 2; i++ {
+		if ud, ok := l.Get(i).(*lua.LUserData); ok {
+			if t, ok := ud.Value.(T); ok {
+				return t
+			}
+		}
+	}
+	return CheckUserData[T](l, 1)
+}
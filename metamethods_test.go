@@ -0,0 +1,69 @@
+package luax
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type money struct {
+	Cents int `lua:"cents"`
+}
+
+func (m *money) String() string {
+	return fmt.Sprintf("$%d.%02d", m.Cents/100, m.Cents%100)
+}
+
+func (m *money) LuaEqual(l *lua.LState, lhs, rhs int) bool {
+	return CheckUserData[*money](l, lhs).Cents == CheckUserData[*money](l, rhs).Cents
+}
+
+func (m *money) LuaLessThan(l *lua.LState, lhs, rhs int) bool {
+	return CheckUserData[*money](l, lhs).Cents < CheckUserData[*money](l, rhs).Cents
+}
+
+func (m *money) LuaAdd(l *lua.LState, lhs, rhs int) int {
+	l.Push(ToLua(l, &money{Cents: CheckUserData[*money](l, lhs).Cents + CheckUserData[*money](l, rhs).Cents}))
+	return 1
+}
+
+func (m *money) LuaMul(l *lua.LState, lhs, rhs int) int {
+	// Either operand may be the number
+	factor := lhs
+	if l.Get(lhs).Type() == lua.LTUserData {
+		factor = rhs
+	}
+	l.Push(ToLua(l, &money{Cents: m.Cents * l.CheckInt(factor)}))
+	return 1
+}
+
+func (m *money) LuaUnm(l *lua.LState) int {
+	l.Push(ToLua(l, &money{Cents: -m.Cents}))
+	return 1
+}
+
+func TestMetamethods(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	RegisterType(l, "money", (*money)(nil))
+	l.SetGlobal("a", ToLua(l, &money{Cents: 150}))
+	l.SetGlobal("b", ToLua(l, &money{Cents: 275}))
+	l.SetGlobal("c", ToLua(l, &money{Cents: 150}))
+
+	if err := l.DoString(`
+		return tostring(a + b), a == c, a ~= b, a < b, b < a,
+			tostring(3 * a), tostring(a * 2), tostring(-(-a))`); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(lua.LString("$4.25"), l.Get(1))
+	assert.Equal(lua.LTrue, l.Get(2))
+	assert.Equal(lua.LTrue, l.Get(3))
+	assert.Equal(lua.LTrue, l.Get(4))
+	assert.Equal(lua.LFalse, l.Get(5))
+	assert.Equal(lua.LString("$4.50"), l.Get(6))
+	assert.Equal(lua.LString("$3.00"), l.Get(7))
+	assert.Equal(lua.LString("$1.50"), l.Get(8))
+}
@@ -0,0 +1,79 @@
+package luax
+
+// MethodSetOption is an option of AllMethods.
+type MethodSetOption func(*methodSetOptions)
+
+type methodSetOptions struct {
+	mapName func(string) string
+	exclude map[string]bool
+}
+
+// MapMethodNames sets the function used to compute the Lua name of each method from its Go name.
+// By default, the Go name is used verbatim.
+func MapMethodNames(f func(string) string) MethodSetOption {
+	return func(o *methodSetOptions) {
+		o.mapName = f
+	}
+}
+
+// ExcludeMethods prevents the methods with the given Go names from being exposed.
+func ExcludeMethods(names ...string) MethodSetOption {
+	return func(o *methodSetOptions) {
+		for _, name := range names {
+			o.exclude[name] = true
+		}
+	}
+}
+
+// hookMethods are the methods used by luax itself, which are never exposed by AllMethods.
+var hookMethods = map[string]bool{
+	"LuaIndex":     true,
+	"LuaNewIndex":  true,
+	"LuaValue":     true,
+	"FromLuaValue": true,
+	// Metamethods
+	"LuaEqual":     true,
+	"LuaLessThan":  true,
+	"LuaLessEqual": true,
+	"LuaLen":       true,
+	"LuaCall":      true,
+	"LuaConcat":    true,
+	"LuaAdd":       true,
+	"LuaSub":       true,
+	"LuaMul":       true,
+	"LuaDiv":       true,
+	"LuaMod":       true,
+	"LuaPow":       true,
+	"LuaUnm":       true,
+}
+
+// AllMethods exposes every exported method of the registered type (including the methods of the pointer type
+// when the type is registered through a pointer) using GoMethod.
+// Methods already defined by previous options are left untouched.
+func AllMethods(opts ...MethodSetOption) TypeOption {
+	o := methodSetOptions{
+		mapName: func(s string) string { return s },
+		exclude: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return typeOptionFunc(func(c *typeConfig) error {
+		for i := 0; i < c.goType.NumMethod(); i++ {
+			m := c.goType.Method(i)
+			if !m.IsExported() || hookMethods[m.Name] || o.exclude[m.Name] {
+				continue
+			}
+
+			name := o.mapName(m.Name)
+			if _, ok := c.funcs[name]; ok {
+				continue
+			}
+			if err := GoMethod(name, m.Func.Interface()).applyType(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
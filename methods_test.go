@@ -0,0 +1,74 @@
+package luax
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type conn struct {
+	Host string `lua:"host"`
+	sent []string
+}
+
+func (c *conn) SendMessage(msg string) int {
+	c.sent = append(c.sent, msg)
+	return len(c.sent)
+}
+
+func (c *conn) HTTPStatus() string {
+	return "OK " + c.Host
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func TestAllMethods(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	RegisterTypeWithOptions(l, "conn", (*conn)(nil),
+		LuaMethod("close", func(c *conn, l *lua.LState) int {
+			l.Push(lua.LString("custom close"))
+			return 1
+		}),
+		AllMethods(
+			MapMethodNames(ToSnakeCase),
+			ExcludeMethods("Close"),
+		),
+	)
+
+	c := &conn{Host: "localhost"}
+	l.SetGlobal("c", ToLua(l, c))
+	if err := l.DoString(`
+		c:send_message("a")
+		return c:send_message("b"), c:http_status(), c:close(), c.SendMessage`); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(lua.LNumber(2), l.Get(1))
+	assert.Equal(lua.LString("OK localhost"), l.Get(2))
+	assert.Equal(lua.LString("custom close"), l.Get(3))
+	assert.Equal(lua.LNil, l.Get(4))
+	assert.Equal([]string{"a", "b"}, c.sent)
+}
+
+func TestAllMethodsMetamethods(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	RegisterTypeWithOptions(l, "money", (*money)(nil), AllMethods())
+	l.SetGlobal("a", ToLua(l, &money{Cents: 150}))
+	l.SetGlobal("b", ToLua(l, &money{Cents: 275}))
+
+	if err := l.DoString(`
+		return a:String(), (a + b):String(), a.LuaAdd, a.LuaEqual, a.LuaUnm`); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(lua.LString("$1.50"), l.Get(1))
+	assert.Equal(lua.LString("$4.25"), l.Get(2))
+	assert.Equal(lua.LNil, l.Get(3))
+	assert.Equal(lua.LNil, l.Get(4))
+	assert.Equal(lua.LNil, l.Get(5))
+}
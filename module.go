@@ -41,6 +41,21 @@ func LuaFunction(name string, f lua.LGFunction) PreloadOption {
 	}
 }
 
+// GoFunction adds a function named name calling the Go function f.
+// Lua arguments are converted to the parameter types of f the same way ToGo does, and results are converted
+// using ToLua.
+// If the last result of f is an error, a non-nil value raises a Lua error, unless the ReturnErrors option is set.
+func GoFunction(name string, f any, opts ...FuncOption) PreloadOption {
+	return func(l *lua.LState, module *lua.LTable) error {
+		fn, err := newGoFunction(f, opts...)
+		if err != nil {
+			return fmt.Errorf("function %s: %w", name, err)
+		}
+		module.RawSetString(name, l.NewClosure(fn))
+		return nil
+	}
+}
+
 func Table(name string, opts ...PreloadOption) PreloadOption {
 	return func(l *lua.LState, module *lua.LTable) error {
 		t := l.NewTable()
@@ -0,0 +1,60 @@
+package luax
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type item struct {
+	Name  string `lua:"name"`
+	Count int    `lua:"count"`
+}
+
+func listItems(prefix string, count int) ([]item, error) {
+	if count < 0 {
+		return nil, errors.New("negative count")
+	}
+	items := make([]item, count)
+	for i := range items {
+		items[i] = item{Name: prefix, Count: i + 1}
+	}
+	return items, nil
+}
+
+func TestGoFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	PreloadModule(l, "mymodule",
+		GoFunction("list", listItems),
+		GoFunction("try_list", listItems, ReturnErrors()),
+		GoFunction("sum", func(values ...int) int {
+			sum := 0
+			for _, v := range values {
+				sum += v
+			}
+			return sum
+		}),
+	)
+
+	if err := l.DoString(`
+		local mymodule = require "mymodule"
+		local items = mymodule.list("x", 2)
+		local ok, err = mymodule.try_list("x", -1)
+		return #items, items[2].name, items[2].count, ok, err, mymodule.sum(1, 2, 3)
+		`); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(lua.LNumber(2), l.Get(1))
+	assert.Equal(lua.LString("x"), l.Get(2))
+	assert.Equal(lua.LNumber(2), l.Get(3))
+	assert.Equal(lua.LNil, l.Get(4))
+	assert.Equal(lua.LString("negative count"), l.Get(5))
+	assert.Equal(lua.LNumber(6), l.Get(6))
+
+	err := l.DoString(`require("mymodule").list("x", -1)`)
+	assert.ErrorContains(err, "negative count")
+}
@@ -0,0 +1,80 @@
+package luax
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy defines how the Lua name of a struct field is derived from its Go name, when it has no explicit name.
+type NamingStrategy int
+
+const (
+	// GoNames uses Go field names verbatim. This is the default.
+	GoNames NamingStrategy = iota
+	// SnakeCaseNames converts Go field names using ToSnakeCase (FieldName becomes field_name).
+	SnakeCaseNames
+	// CamelCaseNames converts Go field names using ToCamelCase (FieldName becomes fieldName).
+	CamelCaseNames
+	// LowerFirstNames converts Go field names using ToLowerFirst (FieldName becomes fieldName, and ID iD).
+	LowerFirstNames
+)
+
+// Apply returns the Lua name of the Go identifier name.
+func (n NamingStrategy) Apply(name string) string {
+	switch n {
+	case SnakeCaseNames:
+		return ToSnakeCase(name)
+	case CamelCaseNames:
+		return ToCamelCase(name)
+	case LowerFirstNames:
+		return ToLowerFirst(name)
+	default:
+		return name
+	}
+}
+
+// ToSnakeCase converts a Go identifier to snake_case (e.g. DoThing becomes do_thing, and HTTPServer http_server).
+func ToSnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := runes[i-1]
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+					b.WriteByte('_')
+				}
+			}
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ToCamelCase converts a Go identifier to camelCase, lowering its leading initialism if any
+// (e.g. DoThing becomes doThing, HTTPServer httpServer, and ID id).
+func ToCamelCase(name string) string {
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsUpper(r) {
+			break
+		}
+		// Keep the last upper case letter of an initialism followed by a lower case letter
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(r)
+	}
+	return string(runes)
+}
+
+// ToLowerFirst converts the first letter of a Go identifier to lower case (e.g. DoThing becomes doThing).
+func ToLowerFirst(name string) string {
+	for i, r := range name {
+		return string(unicode.ToLower(r)) + name[i+len(string(r)):]
+	}
+	return name
+}
@@ -0,0 +1,51 @@
+package luax
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToSnakeCase(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		{"DoThing", "do_thing"},
+		{"HTTPServer", "http_server"},
+		{"ID", "id"},
+		{"UserID", "user_id"},
+		{"Get2Things", "get2_things"},
+		{"already_snake", "already_snake"},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert.Equal(t, c.expected, ToSnakeCase(c.name))
+		})
+	}
+}
+
+func TestNamingStrategies(t *testing.T) {
+	cases := []struct {
+		name      string
+		camelCase string
+		lower     string
+	}{
+		{"DoThing", "doThing", "doThing"},
+		{"HTTPServer", "httpServer", "hTTPServer"},
+		{"ID", "id", "iD"},
+		{"UserID", "userID", "userID"},
+		{"x", "x", "x"},
+		{"", "", ""},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert.Equal(t, c.camelCase, CamelCaseNames.Apply(c.name))
+			assert.Equal(t, c.lower, LowerFirstNames.Apply(c.name))
+			assert.Equal(t, c.name, GoNames.Apply(c.name))
+		})
+	}
+}
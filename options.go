@@ -0,0 +1,216 @@
+package luax
+
+import (
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Option configures the conversions between Go and Lua values.
+// Options can be set for all the conversions of a state using SetOptions, or passed to a single conversion
+// (ToGo, ToLua, Args), in which case they are applied on top of the options of the state.
+type Option func(*options)
+
+type options struct {
+	naming             fieldNaming
+	caseInsensitive    bool
+	strict             bool
+	collectErrors      bool
+	lenientNumbers     bool
+	coerce             bool
+	coerceBools        bool
+	lenientArrays      bool
+	preserveReferences bool
+	mixedTables        MixedTablePolicy
+	emptyTables        EmptyTablePolicy
+	int64Numbers       bool
+	sparseArrays       SparseArrayPolicy
+}
+
+// SparseArrayPolicy defines how tables with holes in their sequence (e.g. {1, nil, 3} or {[5] = "x"}) are decoded to
+// Go slices.
+type SparseArrayPolicy int
+
+const (
+	// SparseArraysAsMaxIndex decodes sparse tables to slices as long as their greatest index, holes being left to
+	// their zero value. Tables with more holes than elements (beyond a few holes) are an error. This is the default.
+	SparseArraysAsMaxIndex SparseArrayPolicy = iota
+	// SparseArraysCompact decodes sparse tables to slices holding their elements in the order of their indexes,
+	// without holes.
+	SparseArraysCompact
+	// SparseArraysError makes sparse tables an error.
+	SparseArraysError
+)
+
+// MixedTablePolicy defines how tables which are neither sequences nor maps with string keys (e.g. tables with both a
+// sequence part and string keys, or sequences with more holes than elements) are decoded to Go interfaces.
+type MixedTablePolicy int
+
+const (
+	// MixedTablesAsMap decodes mixed tables to map[any]any, with keys decoded like values (so sequence indexes keep
+	// their Lua value, starting at 1). This is the default.
+	MixedTablesAsMap MixedTablePolicy = iota
+	// MixedTablesAsStringMap decodes mixed tables to map[string]any, with numeric keys formatted as strings, the way
+	// encoding/json decodes objects. Tables with keys other than strings and numbers are an error.
+	MixedTablesAsStringMap
+	// MixedTablesError makes mixed tables an error.
+	MixedTablesError
+)
+
+// EmptyTablePolicy defines how empty tables are decoded to Go interfaces, since they can be either empty sequences or
+// empty maps.
+type EmptyTablePolicy int
+
+const (
+	// EmptyTablesAsMap decodes empty tables to map[string]any{}. This is the default.
+	EmptyTablesAsMap EmptyTablePolicy = iota
+	// EmptyTablesAsSlice decodes empty tables to []any{}.
+	EmptyTablesAsSlice
+)
+
+// fieldNaming holds the options defining the Lua names of struct fields.
+type fieldNaming struct {
+	strategy NamingStrategy
+	jsonTags bool
+}
+
+// WithNaming sets the naming strategy of struct fields without an explicit name in their lua tag.
+func WithNaming(strategy NamingStrategy) Option {
+	return func(o *options) {
+		o.naming.strategy = strategy
+	}
+}
+
+// JSONTags makes struct fields without a lua tag use their json tag instead, if any.
+func JSONTags() Option {
+	return func(o *options) {
+		o.naming.jsonTags = true
+	}
+}
+
+// CaseInsensitive makes decoding match table keys to struct fields case-insensitively when there is no exact match.
+func CaseInsensitive() Option {
+	return func(o *options) {
+		o.caseInsensitive = true
+	}
+}
+
+// Strict makes decoding fail when a table has keys matching no field of the target struct.
+// All the unknown keys are reported along with their paths.
+// Errors decoding the numeric keys of a struct (numkeys tag option) are also reported instead of being ignored.
+func Strict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// CollectErrors makes decoding go on after an error, and report all the errors at once as ConversionErrors.
+func CollectErrors() Option {
+	return func(o *options) {
+		o.collectErrors = true
+	}
+}
+
+// LenientNumbers disables the checks of numbers converted to Go numeric types: fractional parts are truncated, and
+// out of range values wrap around.
+// By default, converting a number with a fractional part to an integer type, a negative number to an unsigned type,
+// or a number out of the range of the target type is an error.
+func LenientNumbers() Option {
+	return func(o *options) {
+		o.lenientNumbers = true
+	}
+}
+
+// Coerce makes decoding convert strings to numbers and numbers to strings when needed, following the Lua rules
+// (e.g. "42" and " 0x2A " are valid numbers).
+func Coerce() Option {
+	return func(o *options) {
+		o.coerce = true
+	}
+}
+
+// CoerceBools makes decoding parse strings as booleans when needed, using strconv.ParseBool
+// (e.g. "true", "false", "1" or "0").
+func CoerceBools() Option {
+	return func(o *options) {
+		o.coerceBools = true
+	}
+}
+
+// LenientArrays makes decoding accept sequences whose length differs from the length of the target Go array:
+// missing elements are left to their zero value, and extra elements are ignored.
+// By default, such sequences are an error.
+func LenientArrays() Option {
+	return func(o *options) {
+		o.lenientArrays = true
+	}
+}
+
+// PreserveReferences makes a single conversion to Lua map a Go value reached several times (through pointers, maps or
+// slices sharing the same memory) to a single table, instead of a copy per reference.
+// Cyclic Go values, which are an error by default, are then converted to cyclic tables.
+func PreserveReferences() Option {
+	return func(o *options) {
+		o.preserveReferences = true
+	}
+}
+
+// MixedTables sets how tables which are neither sequences nor maps with string keys are decoded to Go interfaces.
+func MixedTables(policy MixedTablePolicy) Option {
+	return func(o *options) {
+		o.mixedTables = policy
+	}
+}
+
+// EmptyTables sets how empty tables are decoded to Go interfaces.
+func EmptyTables(policy EmptyTablePolicy) Option {
+	return func(o *options) {
+		o.emptyTables = policy
+	}
+}
+
+// Int64Numbers makes numbers without a fractional part decode to int64 instead of float64 when decoded to Go
+// interfaces.
+func Int64Numbers() Option {
+	return func(o *options) {
+		o.int64Numbers = true
+	}
+}
+
+// SparseArrays sets how tables with holes in their sequence are decoded to Go slices.
+func SparseArrays(policy SparseArrayPolicy) Option {
+	return func(o *options) {
+		o.sparseArrays = policy
+	}
+}
+
+// SetOptions sets the default conversion options of l, replacing any previously set options.
+func SetOptions(l *lua.LState, opts ...Option) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ud := l.NewUserData()
+	ud.Value = o
+	l.SetField(l.Get(lua.RegistryIndex), "__luax_options", ud)
+}
+
+// defaultOptions are the options of states without options set.
+var defaultOptions = &options{}
+
+// optionsOf returns the options of l, with opts applied.
+// The result must not be modified.
+func optionsOf(l *lua.LState, opts []Option) *options {
+	base := defaultOptions
+	if ud, ok := l.GetField(l.Get(lua.RegistryIndex), "__luax_options").(*lua.LUserData); ok {
+		base = ud.Value.(*options)
+	}
+	if len(opts) == 0 {
+		return base
+	}
+
+	o := *base
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &o
+}
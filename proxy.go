@@ -0,0 +1,274 @@
+package luax
+
+import (
+	"fmt"
+	"reflect"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const proxyTypeName = "luax.proxy"
+
+// NewProxy returns a userdata giving Lua direct access to the Go slice, array or map v.
+// Reads and writes from Lua (t[i], t[i] = x, #t) operate on v itself, without copying it.
+// v must be a slice, a map, or a pointer to a slice, array or map. Pointers are required for arrays to be writable,
+// and allow slices to grow (by assigning to index #t+1) or shrink (by assigning nil to index #t), and nil maps to be
+// allocated on first write.
+//
+// Proxies implement the __pairs and __ipairs metamethods, which the pairs and ipairs functions of gopher-lua ignore:
+// call InstallPairs to iterate over proxies with them.
+func NewProxy(l *lua.LState, v any) (*lua.LUserData, error) {
+	rv := proxyTarget(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+	default:
+		return nil, fmt.Errorf("unsupported proxy type %T: expected slice, array or map", v)
+	}
+
+	ud := l.NewUserData()
+	ud.Value = v
+	ud.Metatable = proxyMetatable(l)
+	return ud, nil
+}
+
+func proxyTarget(rv reflect.Value) reflect.Value {
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		return rv.Elem()
+	}
+	return rv
+}
+
+func proxyMetatable(l *lua.LState) *lua.LTable {
+	if mt, ok := l.GetTypeMetatable(proxyTypeName).(*lua.LTable); ok {
+		return mt
+	}
+
+	mt := l.NewTypeMetatable(proxyTypeName)
+	l.SetFuncs(mt, map[string]lua.LGFunction{
+		"__index":    proxyIndex,
+		"__newindex": proxyNewIndex,
+		"__len":      proxyLen,
+		"__pairs":    proxyPairs,
+		"__ipairs":   proxyIPairs,
+	})
+	return mt
+}
+
+// InstallPairs sets the global pairs and ipairs functions of l to versions honoring the __pairs and __ipairs
+// metamethods (as in Lua 5.2), so that scripts can iterate over proxies. Tables without these metamethods are iterated
+// as usual, whether or not the base library is loaded.
+// InstallPairs must be called again if the globals are reset (e.g. by OpenLibs or a sandbox), and does not affect
+// references to the previous functions (e.g. local pairs = pairs).
+func InstallPairs(l *lua.LState) {
+	l.SetGlobal("pairs", l.NewFunction(func(l *lua.LState) int {
+		return callIterator(l, "__pairs", tablePairs)
+	}))
+	l.SetGlobal("ipairs", l.NewFunction(func(l *lua.LState) int {
+		return callIterator(l, "__ipairs", tableIPairs)
+	}))
+}
+
+// callIterator returns the results of the metamethod event of the first argument, or of iterate if it has none.
+func callIterator(l *lua.LState, event string, iterate lua.LGFunction) int {
+	f := l.GetMetaField(l.Get(1), event)
+	if f.Type() != lua.LTFunction {
+		return iterate(l)
+	}
+	l.Insert(f, 1)
+	l.Call(l.GetTop()-1, 3)
+	return 3
+}
+
+// tablePairs returns the iterator over all the keys of the table argument.
+func tablePairs(l *lua.LState) int {
+	table := l.CheckTable(1)
+	l.Push(l.NewFunction(func(l *lua.LState) int {
+		key, value := table.Next(l.Get(2))
+		if key == lua.LNil {
+			l.Push(lua.LNil)
+			return 1
+		}
+		l.Push(key)
+		l.Push(value)
+		return 2
+	}))
+	l.Push(table)
+	l.Push(lua.LNil)
+	return 3
+}
+
+// tableIPairs returns the iterator over the sequence of the table argument.
+func tableIPairs(l *lua.LState) int {
+	table := l.CheckTable(1)
+	l.Push(l.NewFunction(func(l *lua.LState) int {
+		i := l.CheckInt(2) + 1
+		value := table.RawGetInt(i)
+		if value == lua.LNil {
+			l.Push(lua.LNil)
+			return 1
+		}
+		l.Push(lua.LNumber(i))
+		l.Push(value)
+		return 2
+	}))
+	l.Push(table)
+	l.Push(lua.LNumber(0))
+	return 3
+}
+
+func checkProxy(l *lua.LState) reflect.Value {
+	return proxyTarget(reflect.ValueOf(l.CheckUserData(1).Value))
+}
+
+func proxyIndex(l *lua.LState) int {
+	l.Push(indexValue(l, checkProxy(l), l.Get(2)))
+	return 1
+}
+
+func proxyNewIndex(l *lua.LState) int {
+	ud := l.CheckUserData(1)
+	if err := newIndexValue(l, reflect.ValueOf(ud.Value), l.Get(2), l.Get(3)); err != nil {
+		l.RaiseError(err.Error())
+	}
+	return 0
+}
+
+func proxyLen(l *lua.LState) int {
+	l.Push(lua.LNumber(checkProxy(l).Len()))
+	return 1
+}
+
+func proxyIPairs(l *lua.LState) int {
+	l.Push(l.NewFunction(func(l *lua.LState) int {
+		rv := checkProxy(l)
+		i := l.CheckInt(2)
+		if rv.Kind() == reflect.Map || i >= rv.Len() {
+			return 0
+		}
+		l.Push(lua.LNumber(i + 1))
+		l.Push(ToLua(l, rv.Index(i).Interface()))
+		return 2
+	}))
+	l.Push(l.Get(1))
+	l.Push(lua.LNumber(0))
+	return 3
+}
+
+func proxyPairs(l *lua.LState) int {
+	rv := checkProxy(l)
+	if rv.Kind() != reflect.Map {
+		return proxyIPairs(l)
+	}
+
+	iter := rv.MapRange()
+	l.Push(l.NewFunction(func(l *lua.LState) int {
+		if !iter.Next() {
+			return 0
+		}
+		l.Push(ToLua(l, iter.Key().Interface()))
+		l.Push(ToLua(l, iter.Value().Interface()))
+		return 2
+	}))
+	l.Push(l.Get(1))
+	l.Push(lua.LNil)
+	return 3
+}
+
+// indexValue returns the element key of the slice, array or map rv, or nil if there is none.
+func indexValue(l *lua.LState, rv reflect.Value, key lua.LValue) lua.LValue {
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if i, ok := sequenceIndex(key); ok && i >= 1 && i <= rv.Len() {
+			return ToLua(l, rv.Index(i-1).Interface())
+		}
+	case reflect.Map:
+		mapKey := reflect.New(rv.Type().Key()).Elem()
+		if toGo(l, key, mapKey) == nil {
+			if elem := rv.MapIndex(mapKey); elem.IsValid() {
+				return ToLua(l, elem.Interface())
+			}
+		}
+	}
+	return lua.LNil
+}
+
+// newIndexValue sets the element key of the slice, array or map held by v (possibly through a pointer).
+func newIndexValue(l *lua.LState, v reflect.Value, key, value lua.LValue) error {
+	rv := proxyTarget(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		i, ok := sequenceIndex(key)
+		if !ok {
+			return fmt.Errorf("invalid index %s", key.String())
+		}
+		switch {
+		case i >= 1 && i <= rv.Len():
+			if value == lua.LNil && i == rv.Len() && rv.Kind() == reflect.Slice && rv.CanSet() {
+				// Shrink the slice, as assigning nil to the last element of a sequence would
+				rv.Set(rv.Slice(0, i-1))
+				return nil
+			}
+			elem := rv.Index(i - 1)
+			if !elem.CanSet() {
+				return fmt.Errorf("%v is read-only: use a pointer to make it writable", rv.Type())
+			}
+			if value == lua.LNil {
+				elem.SetZero()
+				return nil
+			}
+			return wrapIndexError(i, toGo(l, value, elem))
+		case i == rv.Len()+1 && rv.Kind() == reflect.Slice && rv.CanSet():
+			elem := reflect.New(rv.Type().Elem()).Elem()
+			if err := toGo(l, value, elem); err != nil {
+				return wrapIndexError(i, err)
+			}
+			rv.Set(reflect.Append(rv, elem))
+			return nil
+		default:
+			return fmt.Errorf("index %d out of range [1, %d]", i, rv.Len())
+		}
+
+	case reflect.Map:
+		mapKey := reflect.New(rv.Type().Key()).Elem()
+		if err := toGo(l, key, mapKey); err != nil {
+			return fmt.Errorf("invalid key %v: %w", key.String(), err)
+		}
+		if value == lua.LNil {
+			if !rv.IsNil() {
+				rv.SetMapIndex(mapKey, reflect.Value{})
+			}
+			return nil
+		}
+		mapValue := reflect.New(rv.Type().Elem()).Elem()
+		if err := toGo(l, value, mapValue); err != nil {
+			return fmt.Errorf("invalid value for key %v: %w", key.String(), err)
+		}
+		if rv.IsNil() {
+			if !rv.CanSet() {
+				return fmt.Errorf("assignment to entry in nil map")
+			}
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		rv.SetMapIndex(mapKey, mapValue)
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported kind %v", rv.Kind())
+	}
+}
+
+func wrapIndexError(i int, err error) error {
+	if err != nil {
+		return fmt.Errorf("index %d: %w", i, err)
+	}
+	return nil
+}
+
+// sequenceIndex returns key as an integer index.
+func sequenceIndex(key lua.LValue) (int, bool) {
+	n, ok := key.(lua.LNumber)
+	if !ok || lua.LNumber(int(n)) != n {
+		return 0, false
+	}
+	return int(n), true
+}
@@ -0,0 +1,151 @@
+package luax
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestProxySlice(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	InstallPairs(l)
+	values := []int{1, 2, 3}
+	proxy, err := NewProxy(l, &values)
+	assert.NoError(err)
+	l.SetGlobal("values", proxy)
+
+	if err := l.DoString(`
+		values[2] = 20
+		values[#values + 1] = 4
+		local sum = 0
+		for i, v in ipairs(values) do
+			sum = sum + i * v
+		end
+		return #values, values[2], values[5], sum`); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(lua.LNumber(4), l.Get(1))
+	assert.Equal(lua.LNumber(20), l.Get(2))
+	assert.Equal(lua.LNil, l.Get(3))
+	assert.Equal(lua.LNumber(1+40+9+16), l.Get(4))
+	assert.Equal([]int{1, 20, 3, 4}, values)
+
+	assert.NoError(l.DoString(`values[#values] = nil`))
+	assert.Equal([]int{1, 20, 3}, values)
+
+	assert.ErrorContains(l.DoString(`values[10] = 1`), "out of range")
+	assert.ErrorContains(l.DoString(`values[1] = "x"`), "index 1")
+
+	// Regular tables are still iterable
+	assert.NoError(l.DoString(`for k, v in pairs({1, 2}) do end`))
+}
+
+func TestProxyMap(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	InstallPairs(l)
+	values := map[string]int{"a": 1, "b": 2}
+	proxy, err := NewProxy(l, values)
+	assert.NoError(err)
+	l.SetGlobal("values", proxy)
+
+	if err := l.DoString(`
+		values.c = 3
+		values.a = nil
+		local sum = 0
+		for k, v in pairs(values) do
+			sum = sum + v
+		end
+		return values.b, values.a, sum`); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(lua.LNumber(2), l.Get(1))
+	assert.Equal(lua.LNil, l.Get(2))
+	assert.Equal(lua.LNumber(5), l.Get(3))
+	assert.Equal(map[string]int{"b": 2, "c": 3}, values)
+
+	_, err = NewProxy(l, 42)
+	assert.Error(err)
+}
+
+type playlist struct {
+	Name   string            `lua:"name"`
+	Songs  []string          `lua:",numkeys"`
+	Tags   map[string]string `lua:"tags,proxy"`
+	Scores [3]int            `lua:"scores,proxy"`
+}
+
+func TestProxyStructFields(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	RegisterType(l, "playlist", (*playlist)(nil))
+	p := &playlist{Name: "mix", Songs: []string{"a", "b"}}
+	l.SetGlobal("p", ToLua(l, p))
+
+	if err := l.DoString(`
+		p[3] = "c"
+		p.tags.genre = "rock"
+		p.scores[2] = 5
+		return p[1], #p.scores`); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(lua.LString("a"), l.Get(1))
+	assert.Equal(lua.LNumber(3), l.Get(2))
+	assert.Equal([]string{"a", "b", "c"}, p.Songs)
+	assert.Equal(map[string]string{"genre": "rock"}, p.Tags)
+	assert.Equal([3]int{0, 5, 0}, p.Scores)
+}
+
+func TestProxyReadOnlyArray(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	proxy, err := NewProxy(l, [3]int{1, 2, 3})
+	assert.NoError(err)
+	l.SetGlobal("values", proxy)
+
+	assert.NoError(l.DoString(`assert(values[2] == 2)`))
+	assert.ErrorContains(l.DoString(`values[1] = 5`), "[3]int is read-only: use a pointer to make it writable")
+}
+
+func TestProxyKeepsGlobals(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	pairs := l.GetGlobal("pairs")
+	RegisterType(l, "playlist", (*playlist)(nil))
+	l.SetGlobal("p", ToLua(l, &playlist{Tags: map[string]string{"genre": "rock"}}))
+	_, err := NewProxy(l, []int{1})
+	assert.NoError(err)
+	assert.Equal(pairs, l.GetGlobal("pairs"))
+}
+
+func TestInstallPairs(t *testing.T) {
+	assert := assert.New(t)
+
+	// Without the base library
+	l := lua.NewState(lua.Options{SkipOpenLibs: true})
+	InstallPairs(l)
+	proxy, err := NewProxy(l, map[string]int{"a": 1})
+	assert.NoError(err)
+	l.SetGlobal("values", proxy)
+
+	assert.NoError(l.DoString(`
+		local count = 0
+		for k, v in pairs(values) do
+			count = count + v
+		end
+		for k, v in pairs({a = 2, b = 3, 4}) do
+			count = count + v
+		end
+		for i, v in ipairs({5, 6, nil, 7}) do
+			count = count + i * v
+		end
+		return count`))
+	assert.Equal(lua.LNumber(1+2+3+4+5+12), l.Get(-1))
+}
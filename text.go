@@ -0,0 +1,83 @@
+package luax
+
+import (
+	"encoding"
+	"net/url"
+	"reflect"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+var urlType = reflect.TypeOf(url.URL{})
+
+// textToLua converts values implementing encoding.TextMarshaler (and url.URL values, which only provide a binary
+// marshaler) to strings.
+// It returns false if rv cannot be marshaled as text.
+func textToLua(rv reflect.Value) (lua.LValue, bool, error) {
+	if rv.Type() == urlType {
+		u := rv.Interface().(url.URL)
+		return lua.LString(u.String()), true, nil
+	}
+
+	marshaler, ok := asInterface[encoding.TextMarshaler](rv)
+	if !ok {
+		return nil, false, nil
+	}
+	text, err := marshaler.MarshalText()
+	if err != nil {
+		return nil, true, err
+	}
+	return lua.LString(text), true, nil
+}
+
+// textToGo converts strings (and numbers, using their string representation) to targets implementing
+// encoding.TextUnmarshaler, or to url.URL targets.
+// It returns false if target cannot be unmarshaled from text or v is neither a string nor a number, so that other
+// values (e.g. tables for structs implementing encoding.TextUnmarshaler) are decoded as usual.
+func textToGo(v lua.LValue, target reflect.Value) (bool, error) {
+	var unmarshal func(text string) error
+	if target.Type() == urlType {
+		unmarshal = func(text string) error {
+			u, err := url.Parse(text)
+			if err != nil {
+				return err
+			}
+			target.Set(reflect.ValueOf(*u))
+			return nil
+		}
+	} else if unmarshaler, ok := asInterface[encoding.TextUnmarshaler](addrOf(target)); ok && target.CanAddr() {
+		unmarshal = func(text string) error {
+			return unmarshaler.UnmarshalText([]byte(text))
+		}
+	} else {
+		return false, nil
+	}
+
+	switch v := v.(type) {
+	case lua.LString:
+		return true, unmarshal(string(v))
+	case lua.LNumber:
+		return true, unmarshal(v.String())
+	}
+	return false, nil
+}
+
+// asInterface returns rv, or a pointer to rv if it is addressable, as a T.
+// Nil pointers are never returned.
+func asInterface[T any](rv reflect.Value) (T, bool) {
+	var zero T
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return zero, false
+	}
+	if rv.CanInterface() {
+		if t, ok := rv.Interface().(T); ok {
+			return t, true
+		}
+	}
+	if rv.Kind() != reflect.Pointer && rv.CanAddr() {
+		if t, ok := rv.Addr().Interface().(T); ok {
+			return t, true
+		}
+	}
+	return zero, false
+}
@@ -0,0 +1,108 @@
+package luax
+
+import (
+	"errors"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type userID struct {
+	n string
+}
+
+func (id userID) MarshalText() ([]byte, error) {
+	return []byte("user-" + id.n), nil
+}
+
+func (id *userID) UnmarshalText(text []byte) error {
+	n, ok := strings.CutPrefix(string(text), "user-")
+	if !ok {
+		return errors.New("invalid user id")
+	}
+	id.n = n
+	return nil
+}
+
+type textValues struct {
+	IP    net.IP     `lua:"ip"`
+	Addr  netip.Addr `lua:"addr"`
+	URL   *url.URL   `lua:"url"`
+	Big   *big.Int   `lua:"big"`
+	ID    userID     `lua:"id"`
+	IDs   []userID   `lua:"ids"`
+	NoURL *url.URL   `lua:"no_url"`
+}
+
+func TestTextMarshaling(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`return {
+		ip = "192.168.1.1",
+		addr = "::1",
+		url = "https://example.com/path?q=1",
+		big = "123456789012345678901234567890",
+		id = "user-42",
+		ids = { "user-1", "user-2" },
+	}`))
+
+	var v textValues
+	require.NoError(ToGo(l, l.Get(-1), &v))
+	assert.Equal(net.ParseIP("192.168.1.1"), v.IP)
+	assert.Equal(netip.MustParseAddr("::1"), v.Addr)
+	assert.Equal("example.com", v.URL.Host)
+	assert.Equal("123456789012345678901234567890", v.Big.String())
+	assert.Equal(userID{n: "42"}, v.ID)
+	assert.Equal([]userID{{n: "1"}, {n: "2"}}, v.IDs)
+	assert.Nil(v.NoURL)
+
+	table := ToLua(l, &v).(*lua.LTable)
+	assert.Equal(lua.LString("192.168.1.1"), table.RawGetString("ip"))
+	assert.Equal(lua.LString("::1"), table.RawGetString("addr"))
+	assert.Equal(lua.LString("https://example.com/path?q=1"), table.RawGetString("url"))
+	assert.Equal(lua.LString("123456789012345678901234567890"), table.RawGetString("big"))
+	assert.Equal(lua.LString("user-42"), table.RawGetString("id"))
+	assert.Equal(lua.LNil, table.RawGetString("no_url"))
+
+	require.NoError(l.DoString(`return { id = "group-1" }`))
+	assert.EqualError(ToGo(l, l.Get(-1), &v), "id: invalid user id")
+	require.NoError(l.DoString(`return { addr = true }`))
+	assert.EqualError(ToGo(l, l.Get(-1), &v), "addr: type error: expected table, got boolean")
+}
+
+type endpoint struct {
+	Host string `lua:"host"`
+	Port int    `lua:"port"`
+}
+
+func (e *endpoint) UnmarshalText(text []byte) error {
+	host, port, err := net.SplitHostPort(string(text))
+	if err != nil {
+		return err
+	}
+	e.Host = host
+	e.Port, err = strconv.Atoi(port)
+	return err
+}
+
+func TestTextUnmarshalerFromTable(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`return { "example.com:80", { host = "localhost", port = 8080 } }`))
+
+	var endpoints []endpoint
+	require.NoError(ToGo(l, l.Get(-1), &endpoints))
+	assert.Equal([]endpoint{{Host: "example.com", Port: 80}, {Host: "localhost", Port: 8080}}, endpoints)
+}
@@ -0,0 +1,110 @@
+package luax
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// scalarToLua converts time.Duration values to strings such as "1m30s", and time.Time values to RFC 3339 strings.
+// It returns false if rv is not of one of these types.
+func scalarToLua(rv reflect.Value) (lua.LValue, bool) {
+	switch rv.Type() {
+	case durationType:
+		return lua.LString(time.Duration(rv.Int()).String()), true
+	case timeType:
+		return lua.LString(rv.Interface().(time.Time).Format(time.RFC3339Nano)), true
+	}
+	return nil, false
+}
+
+// scalarToGo converts v to a time.Duration or time.Time target.
+// Durations are decoded from strings accepted by time.ParseDuration, or numbers of seconds.
+// Times are decoded from RFC 3339 strings, or Unix timestamps in seconds.
+// It returns false if target is not of one of these types.
+func scalarToGo(v lua.LValue, target reflect.Value) (bool, error) {
+	switch target.Type() {
+	case durationType:
+		switch v := v.(type) {
+		case lua.LString:
+			d, err := time.ParseDuration(strings.TrimSpace(string(v)))
+			if err != nil {
+				return true, err
+			}
+			target.SetInt(int64(d))
+			return true, nil
+		case lua.LNumber:
+			d := float64(v) * float64(time.Second)
+			if math.IsNaN(d) || d < math.MinInt64 || d >= math.MaxInt64 {
+				return true, fmt.Errorf("number %v overflows %v", v, target.Type())
+			}
+			target.SetInt(int64(d))
+			return true, nil
+		}
+		return true, fmt.Errorf("type error: expected %v or %v, got %v", lua.LTString, lua.LTNumber, v.Type())
+
+	case timeType:
+		switch v := v.(type) {
+		case lua.LString:
+			t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(v)))
+			if err != nil {
+				return true, err
+			}
+			target.Set(reflect.ValueOf(t))
+			return true, nil
+		case lua.LNumber:
+			sec, frac := math.Modf(float64(v))
+			target.Set(reflect.ValueOf(time.Unix(int64(sec), int64(frac*1e9))))
+			return true, nil
+		}
+		return true, fmt.Errorf("type error: expected %v or %v, got %v", lua.LTString, lua.LTNumber, v.Type())
+	}
+	return false, nil
+}
+
+var byteSizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+// parseByteSize parses a human-friendly byte size such as "10MB" or "1.5 GiB".
+// Units are case-insensitive; KB, MB, GB, TB and PB are powers of 1000, and KiB, MiB, GiB, TiB and PiB powers of 1024.
+func parseByteSize(s string) (lua.LNumber, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.')
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid byte size %q: unknown unit", s)
+	}
+	return lua.LNumber(math.Round(n * unit)), nil
+}
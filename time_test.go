@@ -0,0 +1,64 @@
+package luax
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type timeouts struct {
+	Read     time.Duration   `lua:"read"`
+	Write    time.Duration   `lua:"write"`
+	Idle     time.Duration   `lua:"idle,default=1m"`
+	Started  time.Time       `lua:"started"`
+	Expires  *time.Time      `lua:"expires"`
+	MaxBody  int64           `lua:"max_body,bytesize"`
+	MaxCache uint64          `lua:"max_cache,bytesize,default=1.5KiB"`
+	Parts    []time.Duration `lua:"parts"`
+}
+
+func TestTimeConversions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`return {
+		read = "5s",
+		write = 1.5,
+		started = "2024-03-01T10:00:00Z",
+		expires = 1700000000,
+		max_body = "10MB",
+		parts = { "1h", 60 },
+	}`))
+
+	var v timeouts
+	require.NoError(ToGo(l, l.Get(-1), &v))
+	assert.Equal(5*time.Second, v.Read)
+	assert.Equal(1500*time.Millisecond, v.Write)
+	assert.Equal(time.Minute, v.Idle)
+	assert.Equal(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), v.Started)
+	assert.Equal(time.Unix(1700000000, 0), *v.Expires)
+	assert.Equal(int64(10_000_000), v.MaxBody)
+	assert.Equal(uint64(1536), v.MaxCache)
+	assert.Equal([]time.Duration{time.Hour, time.Minute}, v.Parts)
+
+	table := ToLua(l, v).(*lua.LTable)
+	assert.Equal(lua.LString("5s"), table.RawGetString("read"))
+	assert.Equal(lua.LString("2024-03-01T10:00:00Z"), table.RawGetString("started"))
+	assert.Equal(lua.LNumber(10_000_000), table.RawGetString("max_body"))
+
+	// Round trip
+	var decoded timeouts
+	require.NoError(ToGo(l, table, &decoded))
+	assert.Equal(v.Read, decoded.Read)
+	assert.True(v.Started.Equal(decoded.Started))
+	assert.True(v.Expires.Equal(*decoded.Expires))
+
+	require.NoError(l.DoString(`return { read = "5 parsecs" }`))
+	assert.ErrorContains(ToGo(l, l.Get(-1), &v), "read: time: unknown unit")
+	require.NoError(l.DoString(`return { max_body = "10 bananas" }`))
+	assert.ErrorContains(ToGo(l, l.Get(-1), &v), "max_body: invalid byte size")
+}
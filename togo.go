@@ -1,8 +1,13 @@
 package luax
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	lua "github.com/yuin/gopher-lua"
@@ -12,13 +17,250 @@ type FromLuaValuer interface {
 	FromLuaValue(*lua.LState, lua.LValue) error
 }
 
-func ToGo(l *lua.LState, v lua.LValue, target any) error {
+// ToGo converts the Lua value v to the Go value pointed to by target.
+// opts are applied on top of the options of l.
+func ToGo(l *lua.LState, v lua.LValue, target any, opts ...Option) error {
 	targetValue := reflect.ValueOf(target)
 	if targetValue.Kind() != reflect.Pointer {
 		return fmt.Errorf("unsupported kind %v, must be %v", targetValue.Kind(), reflect.Pointer)
 	}
 
-	return toGo(l, v, targetValue.Elem())
+	return newDecoder(l, opts).decode(v, targetValue.Elem())
+}
+
+// Get converts the Lua value v to a T.
+// opts are applied on top of the options of l.
+func Get[T any](l *lua.LState, v lua.LValue, opts ...Option) (T, error) {
+	var res T
+	err := ToGo(l, v, &res, opts...)
+	return res, err
+}
+
+// decoder holds the state of a conversion from Lua to Go.
+type decoder struct {
+	l    *lua.LState
+	opts *options
+	// path is the path of the value being converted, as a list of segments (.field or [index])
+	path []pathSegment
+	// errs are the errors collected so far, including unknown keys in strict mode
+	errs []collectedError
+	// visiting are the tables being decoded to recursive types (see recursiveType), with these types, innermost last,
+	// used to detect cycles
+	visiting []tableRef
+	// refs are the pointers, maps and slices decoded from tables, reused when a table is reached again
+	refs map[tableRef]reflect.Value
+	// anys are the values decoded from tables by toGoAny
+	anys map[*lua.LTable]any
+	// detached is set when decoding outside of the goroutine running l, in which case values requiring l cannot be
+	// decoded
+	detached bool
+}
+
+// collectedError is an error collected while decoding, with the path segments where it occurred.
+type collectedError struct {
+	path []pathSegment
+	err  *ConversionError
+}
+
+// tableRef identifies the decoding of a table to a Go type.
+type tableRef struct {
+	table *lua.LTable
+	t     reflect.Type
+}
+
+func newDecoder(l *lua.LState, opts []Option) *decoder {
+	return &decoder{
+		l:    l,
+		opts: optionsOf(l, opts),
+	}
+}
+
+// toGo converts v to target using the options of l.
+func toGo(l *lua.LState, v lua.LValue, target reflect.Value) error {
+	return newDecoder(l, nil).decode(v, target)
+}
+
+// decode converts v to target, and reports the collected errors, if any.
+func (d *decoder) decode(v lua.LValue, target reflect.Value) error {
+	if err := d.toGo(v, target); err != nil {
+		return err
+	}
+	if len(d.errs) > 0 {
+		collected := d.errs
+		d.errs = nil
+		sort.SliceStable(collected, func(i, j int) bool {
+			return comparePaths(collected[i].path, collected[j].path) < 0
+		})
+		errs := make(ConversionErrors, len(collected))
+		for i, c := range collected {
+			errs[i] = c.err
+		}
+		return errs
+	}
+	return nil
+}
+
+// record adds err to the collected errors.
+func (d *decoder) record(err *ConversionError) {
+	d.errs = append(d.errs, collectedError{path: append([]pathSegment(nil), d.path...), err: err})
+}
+
+// comparePaths compares the paths a and b segment by segment, numeric indexes being compared as numbers.
+func comparePaths(a, b []pathSegment) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		x, xok := a[i].number()
+		y, yok := b[i].number()
+		switch {
+		case xok && yok && x < y:
+			return -1
+		case xok && yok && x > y:
+			return 1
+		}
+		return strings.Compare(a[i].String(), b[i].String())
+	}
+	return len(a) - len(b)
+}
+
+// leave removes the innermost table from the tables being visited.
+func (d *decoder) leave() {
+	d.visiting = d.visiting[:len(d.visiting)-1]
+}
+
+// share records target as the value decoded from the table v, so that it is reused if v is reached again while
+// decoding to the same type. This allows tables referencing themselves to be decoded to pointers, maps and slices.
+func (d *decoder) share(v lua.LValue, target reflect.Value) {
+	if table, ok := v.(*lua.LTable); ok {
+		if d.refs == nil {
+			d.refs = make(map[tableRef]reflect.Value)
+		}
+		d.refs[tableRef{table: table, t: target.Type()}] = target
+	}
+}
+
+// fail returns err as a *ConversionError for the value v at the current path, converted to a value of type expected.
+// If errors are collected, the error is recorded and nil is returned so that the conversion goes on.
+func (d *decoder) fail(expected reflect.Type, v lua.LValue, err error) error {
+	convErr, ok := err.(*ConversionError)
+	if ok {
+		// Already reported
+		return err
+	}
+
+	convErr = &ConversionError{
+		Path:     d.pathString(),
+		Expected: expected,
+		Actual:   v.Type(),
+		Err:      err,
+	}
+	if d.opts.collectErrors {
+		d.record(convErr)
+		return nil
+	}
+	return convErr
+}
+
+// toGo converts v to target.
+// Errors are returned as *ConversionError (see fail).
+func (d *decoder) toGo(v lua.LValue, target reflect.Value) error {
+	if err := d.toGoValue(v, target); err != nil {
+		return d.fail(target.Type(), v, err)
+	}
+	return nil
+}
+
+func (d *decoder) push(segment pathSegment) {
+	d.path = append(d.path, segment)
+}
+
+func (d *decoder) pop() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// pathString returns the current path (e.g. servers[3].port).
+func (d *decoder) pathString() string {
+	var b strings.Builder
+	for _, segment := range d.path {
+		b.WriteString(segment.String())
+	}
+	return strings.TrimPrefix(b.String(), ".")
+}
+
+// segmentKind is the kind of a path segment.
+type segmentKind uint8
+
+const (
+	fieldKind segmentKind = iota
+	indexKind
+	keyKind
+)
+
+// pathSegment is a segment of the path of the value being decoded.
+// Segments are only formatted when reporting an error, so that pushing them does not allocate.
+type pathSegment struct {
+	kind  segmentKind
+	name  string
+	index int
+	key   lua.LValue
+}
+
+// fieldSegment returns the path segment of a struct field.
+func fieldSegment(name string) pathSegment {
+	return pathSegment{kind: fieldKind, name: name}
+}
+
+// indexSegment returns the path segment of an array index.
+func indexSegment(i int) pathSegment {
+	return pathSegment{kind: indexKind, index: i}
+}
+
+// keySegment returns the path segment of a table key.
+func keySegment(key lua.LValue) pathSegment {
+	return pathSegment{kind: keyKind, key: key}
+}
+
+// String returns the text of the segment (.field or [index]).
+func (s pathSegment) String() string {
+	switch s.kind {
+	case fieldKind:
+		return "." + s.name
+	case indexKind:
+		return "[" + strconv.Itoa(s.index) + "]"
+	}
+	switch key := s.key.(type) {
+	case lua.LString:
+		if isIdentifier(string(key)) {
+			return "." + string(key)
+		}
+		return "[" + strconv.Quote(string(key)) + "]"
+	default:
+		return "[" + key.String() + "]"
+	}
+}
+
+// number returns the number of a segment of an index or numeric key.
+func (s pathSegment) number() (float64, bool) {
+	if s.kind == indexKind {
+		return float64(s.index), true
+	}
+	if key, ok := s.key.(lua.LNumber); ok {
+		return float64(key), true
+	}
+	return 0, false
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
 }
 
 func asFromLuaValuer(v reflect.Value) FromLuaValuer {
@@ -40,7 +282,7 @@ func asFromLuaValuer(v reflect.Value) FromLuaValuer {
 	return nil
 }
 
-func toGo(l *lua.LState, v lua.LValue, target reflect.Value) error {
+func (d *decoder) toGoValue(v lua.LValue, target reflect.Value) error {
 	// Check if source and target are of the same type
 	rv := reflect.ValueOf(v)
 	if rv.Type() == target.Type() {
@@ -62,66 +304,106 @@ func toGo(l *lua.LState, v lua.LValue, target reflect.Value) error {
 	}
 
 	if fromLuaValuer := asFromLuaValuer(target); fromLuaValuer != nil {
-		return fromLuaValuer.FromLuaValue(l, v)
+		if d.detached {
+			return errDetached(target.Type())
+		}
+		return fromLuaValuer.FromLuaValue(d.l, v)
+	}
+
+	if ok, err := scalarToGo(v, target); ok {
+		return err
+	}
+
+	if ok, err := textToGo(v, target); ok {
+		return err
+	}
+
+	if table, ok := v.(*lua.LTable); ok {
+		switch target.Kind() {
+		case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Pointer:
+			key := tableRef{table: table, t: target.Type()}
+			if ref, ok := d.refs[key]; ok {
+				target.Set(ref)
+				return nil
+			}
+			if recursiveType(target.Type()) {
+				// Only values of recursive types can hold the table being decoded
+				if slices.Contains(d.visiting, key) {
+					return fmt.Errorf("cycle detected: table contains itself and cannot be decoded to %v", target.Type())
+				}
+				d.visiting = append(d.visiting, key)
+				defer d.leave()
+			}
+		}
 	}
 
 	switch target.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		if v, ok := v.(lua.LNumber); ok {
-			target.SetInt(int64(v))
-			return nil
+		if v, ok := d.asNumber(v); ok {
+			return d.setInt(float64(v), target)
 		}
 		return fmt.Errorf("type error: expected %v, got %v", lua.LTNumber, v.Type())
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		if v, ok := v.(lua.LNumber); ok {
-			target.SetUint(uint64(v))
-			return nil
+		if v, ok := d.asNumber(v); ok {
+			return d.setUint(float64(v), target)
 		}
 		return fmt.Errorf("type error: expected %v, got %v", lua.LTNumber, v.Type())
 
 	case reflect.Float32, reflect.Float64:
-		if v, ok := v.(lua.LNumber); ok {
-			target.SetFloat(float64(v))
+		if v, ok := d.asNumber(v); ok {
+			n := float64(v)
+			if !d.opts.lenientNumbers && !math.IsInf(n, 0) && !math.IsNaN(n) && target.OverflowFloat(n) {
+				return fmt.Errorf("number %v overflows %v", n, target.Type())
+			}
+			target.SetFloat(n)
 			return nil
 		}
 		return fmt.Errorf("type error: expected %v, got %v", lua.LTNumber, v.Type())
 
 	case reflect.String:
-		if v, ok := v.(lua.LString); ok {
+		if v, ok := d.asString(v); ok {
 			target.SetString(string(v))
 			return nil
 		}
 		return fmt.Errorf("type error: expected %v, got %v", lua.LTString, v.Type())
 
 	case reflect.Bool:
-		if v, ok := v.(lua.LBool); ok {
+		if v, ok := d.asBool(v); ok {
 			target.SetBool(bool(v))
 			return nil
 		}
 		return fmt.Errorf("type error: expected %v, got %v", lua.LTBool, v.Type())
 
 	case reflect.Struct:
-		return toGoStruct(l, v, target)
+		return d.toGoStruct(v, target)
 
 	case reflect.Map:
-		return toGoMap(l, v, target)
+		return d.toGoMap(v, target)
 
 	case reflect.Slice:
-		return toGoSlice(l, v, target, false)
+		if s, ok := v.(lua.LString); ok && target.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte slices are decoded from strings
+			target.SetBytes([]byte(s))
+			return nil
+		}
+		return d.toGoSlice(v, target, false)
+
+	case reflect.Array:
+		return d.toGoArray(v, target, false)
 
 	case reflect.Pointer:
-		var elem reflect.Value
 		if target.IsNil() {
-			elem = reflect.New(target.Type().Elem())
-			target.Set(elem)
-		} else {
-			elem = target.Elem()
+			target.Set(reflect.New(target.Type().Elem()))
 		}
-		return toGo(l, v, elem)
+		d.share(v, target)
+		return d.toGo(v, target.Elem())
 
 	case reflect.Interface:
-		res := toGoAny(l, v)
+		res, err := d.toGoAny(v)
+		if err != nil {
+			return err
+		}
 		if res == nil {
 			target.SetZero()
 		} else {
@@ -129,12 +411,158 @@ func toGo(l *lua.LState, v lua.LValue, target reflect.Value) error {
 		}
 		return nil
 
+	case reflect.Chan:
+		switch v := v.(type) {
+		case *lua.LNilType:
+			target.SetZero()
+			return nil
+		case lua.LChannel:
+			if d.detached {
+				return errDetached(target.Type())
+			}
+			target.Set(d.chanToGo(v, target.Type()))
+			return nil
+		}
+		return fmt.Errorf("type error: expected %v, got %v", lua.LTChannel, v.Type())
+
+	case reflect.Func:
+		switch v := v.(type) {
+		case *lua.LNilType:
+			target.SetZero()
+			return nil
+		case *lua.LFunction:
+			if d.detached {
+				return errDetached(target.Type())
+			}
+			target.Set(newLuaFunction(d.l, v, target.Type()))
+			return nil
+		}
+		return fmt.Errorf("type error: expected %v, got %v", lua.LTFunction, v.Type())
+
 	default:
 		return fmt.Errorf("unsupported target type %v", target.Kind())
 	}
 }
 
-func toGoMap(l *lua.LState, v lua.LValue, target reflect.Value) error {
+// asNumber returns v as a number.
+// If coercion is enabled, strings are converted to numbers following the Lua rules.
+func (d *decoder) asNumber(v lua.LValue) (lua.LNumber, bool) {
+	switch v := v.(type) {
+	case lua.LNumber:
+		return v, true
+	case lua.LString:
+		if d.opts.coerce {
+			return parseNumber(string(v))
+		}
+	}
+	return 0, false
+}
+
+// parseNumber parses s as a Lua number: a decimal number, or a hexadecimal integer with a 0x prefix, with an optional
+// sign and surrounding spaces.
+func parseNumber(s string) (lua.LNumber, bool) {
+	s = strings.Trim(s, " \t\n\r\f\v")
+	unsigned := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	if len(s)-len(unsigned) > 1 {
+		return 0, false
+	}
+
+	if hex, ok := strings.CutPrefix(strings.ToLower(unsigned), "0x"); ok {
+		n, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil {
+			return 0, false
+		}
+		if s[0] == '-' {
+			return -lua.LNumber(n), true
+		}
+		return lua.LNumber(n), true
+	}
+
+	// ParseFloat also accepts inf, nan, underscores and hexadecimal floats, none of which are Lua numbers
+	if strings.ContainsFunc(unsigned, func(r rune) bool { return !strings.ContainsRune("0123456789.eE+-", r) }) {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return lua.LNumber(n), true
+}
+
+// asString returns v as a string.
+// If coercion is enabled, numbers are converted to strings following the Lua rules.
+func (d *decoder) asString(v lua.LValue) (lua.LString, bool) {
+	switch v := v.(type) {
+	case lua.LString:
+		return v, true
+	case lua.LNumber:
+		if d.opts.coerce {
+			return lua.LString(v.String()), true
+		}
+	}
+	return "", false
+}
+
+// asBool returns v as a boolean.
+// If boolean coercion is enabled, strings are parsed using strconv.ParseBool.
+func (d *decoder) asBool(v lua.LValue) (lua.LBool, bool) {
+	switch v := v.(type) {
+	case lua.LBool:
+		return v, true
+	case lua.LString:
+		if d.opts.coerceBools {
+			if b, err := strconv.ParseBool(strings.TrimSpace(string(v))); err == nil {
+				return lua.LBool(b), true
+			}
+		}
+	}
+	return false, false
+}
+
+// setInt sets the signed integer target to n.
+// Unless lenient numbers are enabled, n must be an integer in the range of target.
+func (d *decoder) setInt(n float64, target reflect.Value) error {
+	if !d.opts.lenientNumbers {
+		if err := checkInteger(n); err != nil {
+			return err
+		}
+		if n < math.MinInt64 || n >= math.MaxInt64 || target.OverflowInt(int64(n)) {
+			return fmt.Errorf("number %v overflows %v", n, target.Type())
+		}
+	}
+	target.SetInt(int64(n))
+	return nil
+}
+
+// setUint sets the unsigned integer target to n.
+// Unless lenient numbers are enabled, n must be a non-negative integer in the range of target.
+func (d *decoder) setUint(n float64, target reflect.Value) error {
+	if !d.opts.lenientNumbers {
+		if err := checkInteger(n); err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("negative number %v cannot be converted to %v", n, target.Type())
+		}
+		if n >= math.MaxUint64 || target.OverflowUint(uint64(n)) {
+			return fmt.Errorf("number %v overflows %v", n, target.Type())
+		}
+	}
+	target.SetUint(uint64(n))
+	return nil
+}
+
+func checkInteger(n float64) error {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return fmt.Errorf("number %v is not an integer", n)
+	}
+	if n != math.Trunc(n) {
+		return fmt.Errorf("number %v has a fractional part", n)
+	}
+	return nil
+}
+
+func (d *decoder) toGoMap(v lua.LValue, target reflect.Value) error {
 	if v.Type() != lua.LTTable {
 		return fmt.Errorf("type error: expected %v, got %v", lua.LTTable, v.Type())
 	}
@@ -144,38 +572,48 @@ func toGoMap(l *lua.LState, v lua.LValue, target reflect.Value) error {
 	} else {
 		target.Clear()
 	}
+	d.share(v, target)
 
 	targetType := target.Type()
 	keyType := targetType.Key()
 	valueType := targetType.Elem()
 
 	var err error
-	l.ForEach(v.(*lua.LTable), func(key, value lua.LValue) {
+	d.l.ForEach(v.(*lua.LTable), func(key, value lua.LValue) {
 		if err != nil {
 			return
 		}
 
+		d.push(keySegment(key))
+		defer d.pop()
+
 		mapKey := reflect.New(keyType)
-		if err2 := toGo(l, key, mapKey.Elem()); err2 != nil {
-			err = fmt.Errorf("invalid key %v: %w", key.String(), err2)
+		if err2 := d.toGoValue(key, mapKey.Elem()); err2 != nil {
+			err = d.fail(keyType, key, fmt.Errorf("invalid key: %w", err2))
 			return
 		}
 
 		mapValue := reflect.New(valueType)
-		if err2 := toGo(l, value, mapValue.Elem()); err2 != nil {
-			err = fmt.Errorf("invalid value for key %v: %w", key.String(), err2)
+		if err = d.toGo(value, mapValue.Elem()); err == nil {
+			target.SetMapIndex(mapKey.Elem(), mapValue.Elem())
 		}
-
-		target.SetMapIndex(mapKey.Elem(), mapValue.Elem())
 	})
 	return err
 }
 
-func toGoSlice(l *lua.LState, v lua.LValue, target reflect.Value, ignoreBadKeys bool) error {
+// toGoSlice decodes the sequence v to the slice target.
+// Sequences with holes are decoded according to the SparseArrays option.
+// If ignoreBadKeys is true, keys which are not sequence indexes are ignored instead of being an error.
+func (d *decoder) toGoSlice(v lua.LValue, target reflect.Value, ignoreBadKeys bool) error {
 	if v.Type() != lua.LTTable {
 		return fmt.Errorf("type error: expected %v, got %v", lua.LTTable, v.Type())
 	}
-	count := l.ObjLen(v)
+	table := v.(*lua.LTable)
+
+	indexes, count, compact, err := d.sequence(table, target.Type(), ignoreBadKeys)
+	if err != nil {
+		return err
+	}
 
 	if target.IsNil() || target.Cap() < count {
 		// Nil slice or insufficent capacity: allocate a new slice
@@ -185,63 +623,279 @@ func toGoSlice(l *lua.LState, v lua.LValue, target reflect.Value, ignoreBadKeys
 		target.Set(target.Slice(0, count))
 		target.Clear()
 	}
-	var err error
-	l.ForEach(v.(*lua.LTable), func(key, value lua.LValue) {
+	if !ignoreBadKeys {
+		d.share(v, target)
+	}
+	return d.sequenceToGo(table, indexes, compact, target)
+}
+
+// toGoArray decodes the sequence v to the array target, accepting the same sequences as toGoSlice.
+// The length of the sequence must match the length of the array, unless lenient arrays are enabled.
+func (d *decoder) toGoArray(v lua.LValue, target reflect.Value, ignoreBadKeys bool) error {
+	if v.Type() != lua.LTTable {
+		return fmt.Errorf("type error: expected %v, got %v", lua.LTTable, v.Type())
+	}
+	table := v.(*lua.LTable)
+
+	indexes, count, compact, err := d.sequence(table, target.Type(), ignoreBadKeys)
+	if err != nil {
+		return err
+	}
+	if count != target.Len() && !d.opts.lenientArrays {
+		return fmt.Errorf("length error: expected %d elements, got %d", target.Len(), count)
+	}
+
+	target.SetZero()
+	return d.sequenceToGo(table, indexes, compact, target)
+}
+
+// sequence returns the sorted indexes of the sequence table, and the length of the slice or array of type t to decode
+// it to. If compact is true, sequences with holes are decoded to consecutive elements (see SparseArraysCompact).
+// The table is read without invoking metamethods.
+func (d *decoder) sequence(table *lua.LTable, t reflect.Type, ignoreBadKeys bool) ([]int, int, bool, error) {
+	var (
+		indexes  []int
+		maxIndex int
+		err      error
+	)
+	table.ForEach(func(key, _ lua.LValue) {
 		if err != nil {
 			// Short circuit if there's already an error
 			return
 		}
 
-		if key.Type() == lua.LTNumber {
-			i := int(key.(lua.LNumber))
-			if i >= 1 {
-				if err2 := toGo(l, value, target.Index(i-1)); err2 != nil {
-					err = fmt.Errorf("index %d: %w", i, err2)
-				}
-			}
+		if i, ok := sequenceIndex(key); ok && i >= 1 {
+			indexes = append(indexes, i)
+			maxIndex = max(maxIndex, i)
 		} else if !ignoreBadKeys {
-			err = fmt.Errorf("invalid key in array: %s", key.String())
+			d.push(keySegment(key))
+			err = d.fail(t, table, fmt.Errorf("invalid key in array: %s", key.String()))
+			d.pop()
 		}
 	})
-	return err
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	count := maxIndex
+	compact := false
+	if len(indexes) != maxIndex {
+		switch d.opts.sparseArrays {
+		case SparseArraysError:
+			return nil, 0, false, fmt.Errorf("sparse array: %d elements for indexes up to %d", len(indexes), maxIndex)
+		case SparseArraysCompact:
+			count = len(indexes)
+			compact = true
+		default:
+			if !nearlyDense(len(indexes), maxIndex) {
+				return nil, 0, false, fmt.Errorf(
+					"sparse array: %d elements for indexes up to %d, too sparse to be allocated", len(indexes), maxIndex)
+			}
+		}
+	}
+	sort.Ints(indexes)
+	return indexes, count, compact, nil
+}
+
+// sequenceToGo decodes the elements of table at indexes (see sequence) to the slice or array target.
+// Elements beyond the length of target are ignored.
+func (d *decoder) sequenceToGo(table *lua.LTable, indexes []int, compact bool, target reflect.Value) error {
+	for pos, i := range indexes {
+		if !compact {
+			pos = i - 1
+		}
+		if pos >= target.Len() {
+			break
+		}
+		d.push(indexSegment(i))
+		err := d.toGo(table.RawGet(lua.LNumber(i)), target.Index(pos))
+		d.pop()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func toGoStruct(l *lua.LState, v lua.LValue, target reflect.Value) error {
+func (d *decoder) toGoStruct(v lua.LValue, target reflect.Value) error {
 	if v.Type() != lua.LTTable {
 		return fmt.Errorf("type error: expected %v, got %v", lua.LTTable, v.Type())
 	}
 
-	targetType := target.Type()
-	for i := 0; i < targetType.NumField(); i++ {
-		f := targetType.Field(i)
-
-		if f.IsExported() {
-			tag := luaStructTagOf(f)
-			switch {
-			case tag.NumericKeys:
-				toGoSlice(l, v, target.Field(i), true)
-			case !tag.Ignore:
-				fieldValue := l.GetTable(v, lua.LString(tag.FieldName))
-				if fieldValue != lua.LNil {
-					if err := toGo(l, fieldValue, target.Field(i)); err != nil {
-						return fmt.Errorf("field '%s': %w", tag.FieldName, err)
-					}
+	info := cachedStructInfo(target.Type(), d.opts.naming, false)
+	if info.err != nil {
+		return info.err
+	}
+	if d.opts.strict {
+		d.checkUnknownKeys(v.(*lua.LTable), info)
+	}
+
+	var folded map[string]lua.LValue
+	for _, f := range info.fields {
+		if f.tag.NumericKeys {
+			if field := fieldByIndex(target, f.index, true); field.IsValid() {
+				var err error
+				if field.Kind() == reflect.Array {
+					err = d.toGoArray(v, field, true)
+				} else {
+					err = d.toGoSlice(v, field, true)
+				}
+				if err != nil && d.opts.strict {
+					return err
 				}
 			}
+			continue
+		}
+
+		var fieldValue lua.LValue
+		if d.detached {
+			// Metamethods cannot run outside of the goroutine running the state
+			fieldValue = v.(*lua.LTable).RawGetString(f.tag.FieldName)
+		} else {
+			fieldValue = d.l.GetTable(v, lua.LString(f.tag.FieldName))
+		}
+		if fieldValue == lua.LNil && d.opts.caseInsensitive {
+			if folded == nil {
+				folded = foldedKeys(v.(*lua.LTable))
+			}
+			if value, ok := folded[strings.ToLower(f.tag.FieldName)]; ok {
+				fieldValue = value
+			}
+		}
+		d.push(fieldSegment(f.tag.FieldName))
+		err := d.toGoField(fieldValue, target, f)
+		d.pop()
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// toGoField converts the value v of the field f of the struct target.
+func (d *decoder) toGoField(v lua.LValue, target reflect.Value, f structField) error {
+	fieldType := target.Type().FieldByIndex(f.index).Type
+	if v == lua.LNil {
+		switch {
+		case f.tag.Required:
+			return d.fail(fieldType, v, errors.New("required field is missing"))
+		case f.tag.HasDefault:
+			field := fieldByIndex(target, f.index, true)
+			if err := d.defaultToGo(f.tag.Default, field, f.tag.ByteSize); err != nil {
+				return d.fail(fieldType, v, fmt.Errorf("invalid default value: %w", err))
+			}
+		}
+		return nil
+	}
+
+	field := fieldByIndex(target, f.index, true)
+	if !field.IsValid() {
+		return d.fail(fieldType, v, errors.New("cannot set embedded nil pointer"))
+	}
+	if s, ok := v.(lua.LString); ok && f.tag.ByteSize {
+		n, err := parseByteSize(string(s))
+		if err != nil {
+			return d.fail(fieldType, v, err)
+		}
+		v = n
+	}
+	return d.toGo(v, field)
+}
+
+// checkUnknownKeys records the keys of table matching no field of info.
+func (d *decoder) checkUnknownKeys(table *lua.LTable, info *structInfo) {
+	d.l.ForEach(table, func(key, _ lua.LValue) {
+		switch key := key.(type) {
+		case lua.LString:
+			if info.byName[string(key)] != nil {
+				return
+			}
+			if d.opts.caseInsensitive && info.byFoldedName[strings.ToLower(string(key))] != nil {
+				return
+			}
+		case lua.LNumber:
+			if info.numericKeys != nil {
+				return
+			}
+		}
+		d.push(keySegment(key))
+		d.record(&ConversionError{
+			Path:   d.pathString(),
+			Actual: key.Type(),
+			Err:    errors.New("unknown key"),
+		})
+		d.pop()
+	})
+}
+
+// foldedKeys returns the values of table indexed by their lower case string keys.
+func foldedKeys(table *lua.LTable) map[string]lua.LValue {
+	folded := make(map[string]lua.LValue)
+	table.ForEach(func(key, value lua.LValue) {
+		if key, ok := key.(lua.LString); ok {
+			folded[strings.ToLower(string(key))] = value
+		}
+	})
+	return folded
+}
+
+// defaultToGo converts the literal value of a default tag option to target.
+// If byteSize is set, the literal is parsed as a byte size.
+func (d *decoder) defaultToGo(literal string, target reflect.Value, byteSize bool) error {
+	if !target.IsValid() {
+		return fmt.Errorf("cannot set embedded nil pointer")
+	}
+	if byteSize {
+		n, err := parseByteSize(literal)
+		if err != nil {
+			return err
+		}
+		return d.toGoValue(n, target)
+	}
+
+	var v lua.LValue = lua.LString(literal)
+	switch indirectType(target.Type()).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if n, err := strconv.ParseFloat(literal, 64); err == nil {
+			v = lua.LNumber(n)
+		}
+	case reflect.Bool:
+		b, err := strconv.ParseBool(literal)
+		if err != nil {
+			return err
+		}
+		v = lua.LBool(b)
+	}
+	return d.toGoValue(v, target)
+}
+
 type luaStructTag struct {
 	FieldName   string
+	Named       bool
 	Ignore      bool
 	NumericKeys bool
 	Inline      bool
+	Proxy       bool
+	ReadOnly    bool
+	Required    bool
+	OmitEmpty   bool
+	HasDefault  bool
+	ByteSize    bool
+	// Array keeps byte slices encoded as sequences of numbers instead of strings
+	Array bool
+	// Default is the literal default value of the field (default=<literal>), which cannot contain commas
+	Default string
 }
 
-func luaStructTagOf(field reflect.StructField) luaStructTag {
-	tag := field.Tag.Get("lua")
+// luaStructTagOf parses the lua tag of field.
+// If field has no lua tag and naming.jsonTags is set, its json tag is parsed instead.
+func luaStructTagOf(field reflect.StructField, naming fieldNaming) luaStructTag {
+	tag, ok := field.Tag.Lookup("lua")
+	if !ok && naming.jsonTags {
+		tag = field.Tag.Get("json")
+	}
 	parts := strings.Split(tag, ",")
 
 	if len(parts) == 0 {
@@ -258,9 +912,10 @@ func luaStructTagOf(field reflect.StructField) luaStructTag {
 
 	t := luaStructTag{}
 	if parts[0] == "" {
-		t.FieldName = field.Name
+		t.FieldName = naming.strategy.Apply(field.Name)
 	} else {
 		t.FieldName = parts[0]
+		t.Named = true
 	}
 	for i := 1; i < len(parts); i++ {
 		switch parts[i] {
@@ -268,81 +923,158 @@ func luaStructTagOf(field reflect.StructField) luaStructTag {
 			t.NumericKeys = true
 		case "inline":
 			t.Inline = true
+		case "proxy":
+			t.Proxy = true
+		case "readonly":
+			t.ReadOnly = true
+		case "required":
+			t.Required = true
+		case "omitempty":
+			t.OmitEmpty = true
+		case "bytesize":
+			t.ByteSize = true
+		case "array":
+			t.Array = true
+		default:
+			if literal, ok := strings.CutPrefix(parts[i], "default="); ok {
+				t.HasDefault = true
+				t.Default = literal
+			}
 		}
 	}
 	return t
 }
 
-func toGoAny(l *lua.LState, v lua.LValue) any {
+func (d *decoder) toGoAny(v lua.LValue) (any, error) {
 	switch v := v.(type) {
 	case *lua.LNilType:
-		return nil
+		return nil, nil
 	case lua.LBool:
-		return bool(v)
+		return bool(v), nil
 	case lua.LNumber:
-		return float64(v)
+		if d.opts.int64Numbers && math.Abs(float64(v)) < 1<<63 && v == lua.LNumber(int64(v)) {
+			return int64(v), nil
+		}
+		return float64(v), nil
 	case lua.LString:
-		return string(v)
+		return string(v), nil
 	case *lua.LUserData:
-		return v.Value
+		return v.Value, nil
 	case *lua.LTable:
-		var (
-			array    []any
-			strTable map[string]any
-			table    map[any]any
-		)
-
-		l.ForEach(v, func(key, value lua.LValue) {
-			if numKey, ok := key.(lua.LNumber); ok {
-				// Numeric key
-
-				index := int(numKey)
-				switch {
-				case array == nil:
-					array = make([]any, index, v.Len())
-				case cap(array) < index:
-					// Not enough capacity in the slice: append enough elements
-					array = append(array, make([]any, index-cap(array))...)
-				case len(array) < index:
-					// Enough capacity but not enough length: re-slice
-					array = array[:index]
-				}
-				array[index-1] = toGoAny(l, value)
-			} else if strKey, ok := key.(lua.LString); ok {
-				if strTable == nil {
-					strTable = make(map[string]any)
-				}
-				strTable[string(strKey)] = toGoAny(l, value)
-			} else {
-				// Other key
-				if table == nil {
-					table = make(map[any]any)
-				}
-				table[toGoAny(l, key)] = toGoAny(l, value)
-			}
-		})
-
-		switch {
-		case len(array) > 0 && table == nil && strTable == nil:
-			return array
-		case len(array) == 0 && table != nil && strTable == nil:
-			return table
-		case len(array) == 0 && table == nil && strTable != nil:
-			return strTable
-		default:
-			merge(array, strTable, table)
-			return table
+		if res, ok := d.anys[v]; ok {
+			return res, nil
 		}
+		return d.tableToAny(v)
 	default:
-		panic(fmt.Errorf("failed to convert %s", v.Type()))
+		return nil, fmt.Errorf("unsupported type %v", v.Type())
 	}
 }
 
-func merge(array []any, strTable map[string]any, table map[any]any) {
-	for i := range array {
-		table[i] = array[i]
+// maxSparseHoles is the number of holes always allowed in sequences. Beyond it, sequences must hold at least as many
+// elements as holes, so that a few elements with huge indexes (e.g. {[2^40] = "x"}) are not decoded to huge slices.
+const maxSparseHoles = 64
+
+// nearlyDense returns whether a sequence of count elements with indexes up to maxIndex has few enough holes to be
+// decoded to a slice as long as maxIndex.
+func nearlyDense(count, maxIndex int) bool {
+	return maxIndex-count <= max(count, maxSparseHoles)
+}
+
+// tableToAny converts the table v to a []any if its keys are a sequence without too many holes (see nearlyDense), or to
+// a map[string]any if its keys are all strings. Other tables are converted according to the MixedTables and EmptyTables
+// options.
+// The result is recorded before its elements are converted, so that a table referencing itself is converted to a
+// value referencing itself.
+func (d *decoder) tableToAny(v *lua.LTable) (any, error) {
+	var length, indexes, strKeys, numKeys, otherKeys int
+	d.l.ForEach(v, func(key, _ lua.LValue) {
+		if i, ok := sequenceIndex(key); ok && i >= 1 {
+			indexes++
+			length = max(length, i)
+		} else if key.Type() == lua.LTString {
+			strKeys++
+		} else if key.Type() == lua.LTNumber {
+			numKeys++
+		} else {
+			otherKeys++
+		}
+	})
+
+	var (
+		res  any
+		keys = indexes + strKeys + numKeys + otherKeys
+		set  func(key, value any)
+	)
+	switch {
+	case keys == 0 && d.opts.emptyTables == EmptyTablesAsSlice:
+		res = []any{}
+	case keys == 0:
+		res = map[string]any{}
+	case indexes == keys && nearlyDense(indexes, length):
+		array := make([]any, length)
+		res = array
+		set = func(key, value any) {
+			array[key.(int)-1] = value
+		}
+	case strKeys == keys:
+		strTable := make(map[string]any, keys)
+		res = strTable
+		set = func(key, value any) {
+			strTable[key.(string)] = value
+		}
+	case d.opts.mixedTables == MixedTablesError:
+		return nil, fmt.Errorf("mixed table: expected either sequence or string keys")
+	case d.opts.mixedTables == MixedTablesAsStringMap:
+		if otherKeys > 0 {
+			return nil, fmt.Errorf("mixed table: expected string or number keys")
+		}
+		strTable := make(map[string]any, keys)
+		res = strTable
+		set = func(key, value any) {
+			strTable[key.(string)] = value
+		}
+	default:
+		table := make(map[any]any, keys)
+		res = table
+		set = func(key, value any) {
+			table[key] = value
+		}
+	}
+
+	if d.anys == nil {
+		d.anys = make(map[*lua.LTable]any)
 	}
-	for k, v := range strTable {
-		table[k] = v
+	d.anys[v] = res
+
+	var err error
+	d.l.ForEach(v, func(key, value lua.LValue) {
+		if err != nil {
+			return
+		}
+
+		var goKey, goValue any
+		switch res.(type) {
+		case []any:
+			goKey, _ = sequenceIndex(key)
+		case map[string]any:
+			// Numbers are formatted the way Lua does it
+			goKey = key.String()
+		default:
+			if goKey, err = d.toGoAny(key); err != nil {
+				return
+			}
+			if keyType := reflect.TypeOf(goKey); !keyType.Comparable() {
+				// Tables used as keys decode to maps and slices, which cannot be map keys
+				err = d.fail(keyType, key, fmt.Errorf("invalid key: %v is not comparable", keyType))
+				return
+			}
+		}
+		if goValue, err = d.toGoAny(value); err == nil {
+			set(goKey, goValue)
+		}
+	})
+	if err != nil {
+		return nil, err
 	}
+	return res, nil
 }
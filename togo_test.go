@@ -2,6 +2,7 @@ package luax
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -64,7 +65,6 @@ func TestToGo(t *testing.T) {
 			},
 		},
 		{
-			skip: true,
 			lua: func(l *lua.LState) (lua.LValue, error) {
 				err := l.DoString(`return {
 					string = "test",
@@ -150,9 +150,9 @@ func TestToGo(t *testing.T) {
 				return t, nil
 			},
 			target: &anything,
-			expected: &map[string]any{
+			expected: anyPtr(map[string]any{
 				"key": "value",
-			},
+			}),
 		},
 	}
 
@@ -188,3 +188,655 @@ func intPtr(v int) *int {
 func float64Ptr(v float64) *float64 {
 	return &v
 }
+
+func anyPtr(v any) *any {
+	return &v
+}
+
+func BenchmarkToGoStruct(b *testing.B) {
+	l := lua.NewState()
+	v := ToLua(l, newBenchStruct())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var s benchStruct
+		if err := ToGo(l, v, &s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type serverConfig struct {
+	Host    string  `lua:"host,required"`
+	Port    int     `lua:"port,default=8080"`
+	Debug   bool    `lua:"debug,default=true"`
+	Name    string  `lua:"name,default=server"`
+	Ratio   float64 `lua:"ratio,omitempty"`
+	Version string  `lua:"version,readonly"`
+}
+
+func TestStructTagOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+
+	require.NoError(l.DoString(`return { host = "localhost", debug = false }`))
+	var config serverConfig
+	require.NoError(ToGo(l, l.Get(-1), &config))
+	assert.Equal(serverConfig{Host: "localhost", Port: 8080, Debug: false, Name: "server"}, config)
+
+	require.NoError(l.DoString(`return { port = 80 }`))
+	assert.ErrorContains(ToGo(l, l.Get(-1), &config), "host: required field is missing")
+
+	table := ToLua(l, serverConfig{Host: "localhost"}).(*lua.LTable)
+	assert.Equal(lua.LNil, table.RawGetString("ratio"))
+	assert.Equal(lua.LString("localhost"), table.RawGetString("host"))
+	table = ToLua(l, serverConfig{Ratio: 0.5}).(*lua.LTable)
+	assert.Equal(lua.LNumber(0.5), table.RawGetString("ratio"))
+
+	RegisterType(l, "server_config", (*serverConfig)(nil))
+	l.SetGlobal("config", ToLua(l, &serverConfig{Version: "1.0"}))
+	assert.NoError(l.DoString(`config.host = "example.com"`))
+	assert.ErrorContains(l.DoString(`config.version = "2.0"`), "field version is read-only")
+	require.NoError(l.DoString(`return config.version`))
+	assert.Equal(lua.LString("1.0"), l.Get(-1))
+}
+
+type namedStruct struct {
+	FirstName string
+	UserID    int
+	Tagged    string `lua:"explicit"`
+	JSON      string `json:"json_name,omitempty"`
+	Skipped   string `json:"-"`
+}
+
+func TestFieldNaming(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	value := namedStruct{FirstName: "Chuck", UserID: 42, Tagged: "t", JSON: "j", Skipped: "s"}
+
+	table := ToLua(l, value, WithNaming(SnakeCaseNames), JSONTags()).(*lua.LTable)
+	assert.Equal(lua.LString("Chuck"), table.RawGetString("first_name"))
+	assert.Equal(lua.LNumber(42), table.RawGetString("user_id"))
+	assert.Equal(lua.LString("t"), table.RawGetString("explicit"))
+	assert.Equal(lua.LString("j"), table.RawGetString("json_name"))
+	assert.Equal(lua.LNil, table.RawGetString("skipped"))
+
+	var decoded namedStruct
+	require.NoError(ToGo(l, table, &decoded, WithNaming(SnakeCaseNames), JSONTags()))
+	assert.Equal(namedStruct{FirstName: "Chuck", UserID: 42, Tagged: "t", JSON: "j"}, decoded)
+
+	// State options
+	SetOptions(l, WithNaming(CamelCaseNames))
+	table = ToLua(l, value).(*lua.LTable)
+	assert.Equal(lua.LString("Chuck"), table.RawGetString("firstName"))
+	assert.Equal(lua.LString("j"), table.RawGetString("json"))
+
+	// Per-call options are applied on top of state options
+	table = ToLua(l, value, JSONTags()).(*lua.LTable)
+	assert.Equal(lua.LNumber(42), table.RawGetString("userID"))
+	assert.Equal(lua.LString("j"), table.RawGetString("json_name"))
+
+	require.NoError(l.DoString(`return { FIRSTNAME = "Bob", userid = 1 }`))
+	decoded = namedStruct{}
+	require.NoError(ToGo(l, l.Get(-1), &decoded))
+	assert.Equal(namedStruct{}, decoded)
+	require.NoError(ToGo(l, l.Get(-1), &decoded, CaseInsensitive()))
+	assert.Equal(namedStruct{FirstName: "Bob", UserID: 1}, decoded)
+}
+
+func TestFieldNamingUserData(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	SetOptions(l, WithNaming(SnakeCaseNames))
+	RegisterType(l, "named", (*namedStruct)(nil))
+	value := &namedStruct{FirstName: "Chuck"}
+	l.SetGlobal("v", ToLua(l, value))
+	assert.NoError(l.DoString(`v.user_id = 7`))
+	assert.Equal(7, value.UserID)
+}
+
+type strictServer struct {
+	Host string `lua:"host"`
+	Port int    `lua:"port"`
+}
+
+type strictConfig struct {
+	Name    string                  `lua:"name"`
+	Servers []strictServer          `lua:"servers"`
+	Extra   map[string]strictServer `lua:"extra"`
+}
+
+type strictList struct {
+	Name  string `lua:"name"`
+	Items []int  `lua:",numkeys"`
+}
+
+func TestStrict(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`return {
+		name = "test",
+		nmae = "typo",
+		servers = {
+			{ host = "a", port = 80 },
+			{ host = "b", prot = 80 },
+		},
+		extra = {
+			backup = { hots = "c" },
+		},
+		[true] = 1,
+	}`))
+	v := l.Get(-1)
+
+	var config strictConfig
+	require.NoError(ToGo(l, v, &config))
+	assert.Equal("test", config.Name)
+
+	err := ToGo(l, v, &config, Strict())
+	assert.EqualError(err,
+		"extra.backup.hots: unknown key; nmae: unknown key; servers[2].prot: unknown key; [true]: unknown key")
+
+	require.NoError(l.DoString(`return { name = "list", 1, 2, "three" }`))
+	var list strictList
+	require.NoError(ToGo(l, l.Get(-1), &list))
+	assert.EqualError(ToGo(l, l.Get(-1), &list, Strict()), "[3]: type error: expected number, got string")
+}
+
+func TestConversionError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`return {
+		name = 42,
+		servers = {
+			{ host = "a", port = 80 },
+			{ host = "b", port = "80" },
+			{ host = true, port = 80 },
+		},
+		extra = {
+			backup = { port = {} },
+		},
+	}`))
+	v := l.Get(-1)
+
+	var config strictConfig
+	err := ToGo(l, v, &config)
+	var convErr *ConversionError
+	require.ErrorAs(err, &convErr)
+
+	err = ToGo(l, v, &config, CollectErrors())
+	var convErrs ConversionErrors
+	require.ErrorAs(err, &convErrs)
+	require.Len(convErrs, 4)
+
+	assert.Equal("extra.backup.port", convErrs[0].Path)
+	assert.Equal(reflect.TypeOf(0), convErrs[0].Expected)
+	assert.Equal(lua.LTTable, convErrs[0].Actual)
+	assert.Equal("name", convErrs[1].Path)
+	assert.Equal(reflect.TypeOf(""), convErrs[1].Expected)
+	assert.Equal(lua.LTNumber, convErrs[1].Actual)
+	assert.Equal("servers[2].port", convErrs[2].Path)
+	assert.Equal("servers[3].host", convErrs[3].Path)
+	assert.Equal(lua.LTBool, convErrs[3].Actual)
+	assert.EqualError(convErrs[2], "servers[2].port: type error: expected number, got string")
+
+	// Valid values are still decoded
+	assert.Equal("a", config.Servers[0].Host)
+	assert.Equal(80, config.Servers[2].Port)
+}
+
+func TestConversionErrorOrder(t *testing.T) {
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`
+		local servers = {}
+		for i = 1, 12 do
+			servers[i] = { host = "h", port = (i == 2 or i == 10) and "x" or i }
+		end
+		return { servers = servers }
+	`))
+
+	var config strictConfig
+	err := ToGo(l, l.Get(-1), &config, CollectErrors())
+	var convErrs ConversionErrors
+	require.ErrorAs(err, &convErrs)
+	require.Len(convErrs, 2)
+	require.Equal("servers[2].port", convErrs[0].Path)
+	require.Equal("servers[10].port", convErrs[1].Path)
+}
+
+type badDefault struct {
+	Port int `lua:"port,default=http"`
+}
+
+func TestInvalidDefault(t *testing.T) {
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`return { {} }`))
+
+	var servers []badDefault
+	err := ToGo(l, l.Get(-1), &servers)
+	require.EqualError(err, "[1].port: invalid default value: type error: expected number, got string")
+}
+
+func TestNumericChecks(t *testing.T) {
+	cases := []struct {
+		value    lua.LNumber
+		target   any
+		expected any
+		err      string
+		lenient  any
+	}{
+		{value: 42, target: new(int8), expected: int8(42)},
+		{value: 300, target: new(int8), err: "number 300 overflows int8", lenient: int8(44)},
+		{value: -129, target: new(int8), err: "number -129 overflows int8"},
+		{value: -1, target: new(uint16), err: "negative number -1 cannot be converted to uint16"},
+		{value: 65536, target: new(uint16), err: "number 65536 overflows uint16", lenient: uint16(0)},
+		{value: 1.5, target: new(int), err: "number 1.5 has a fractional part", lenient: 1},
+		{value: 1e20, target: new(int64), err: "number 1e+20 overflows int64"},
+		{value: 1e300, target: new(float32), err: "number 1e+300 overflows float32"},
+		{value: 1.5, target: new(float32), expected: float32(1.5)},
+		{value: 4294967295, target: new(uint32), expected: uint32(4294967295)},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert := assert.New(t)
+			l := lua.NewState()
+
+			err := ToGo(l, c.value, c.target)
+			if c.err != "" {
+				assert.EqualError(err, c.err)
+			} else {
+				assert.NoError(err)
+				assert.Equal(c.expected, reflect.ValueOf(c.target).Elem().Interface())
+			}
+
+			if c.lenient != nil {
+				assert.NoError(ToGo(l, c.value, c.target, LenientNumbers()))
+				assert.Equal(c.lenient, reflect.ValueOf(c.target).Elem().Interface())
+			}
+		})
+	}
+}
+
+type coercedArgs struct {
+	Port    int     `lua:"port"`
+	Ratio   float64 `lua:"ratio"`
+	Name    string  `lua:"name"`
+	Enabled bool    `lua:"enabled"`
+}
+
+func TestCoerce(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`return { port = " 0x1F90 ", ratio = "1.5", name = 42, enabled = "true" }`))
+	v := l.Get(-1)
+
+	var args coercedArgs
+	assert.Error(ToGo(l, v, &args))
+	assert.ErrorContains(ToGo(l, v, &args, Coerce()), "enabled: type error: expected boolean, got string")
+	require.NoError(ToGo(l, v, &args, Coerce(), CoerceBools()))
+	assert.Equal(coercedArgs{Port: 8080, Ratio: 1.5, Name: "42", Enabled: true}, args)
+
+	require.NoError(l.DoString(`return { port = "eighty" }`))
+	assert.ErrorContains(ToGo(l, l.Get(-1), &args, Coerce()), "port: type error: expected number, got string")
+
+	// Coercion applies to sequential args
+	l.Push(l.NewFunction(func(l *lua.LState) int {
+		var args coercedArgs
+		require.NoError(Args(l, 1, &args, Coerce(), CoerceBools()))
+		assert.Equal(coercedArgs{Port: 80, Ratio: 0.5, Name: "1", Enabled: false}, args)
+		return 0
+	}))
+	l.Push(lua.LString("80"))
+	l.Push(lua.LString("0.5"))
+	l.Push(lua.LNumber(1))
+	l.Push(lua.LString("0"))
+	l.Call(4, 0)
+}
+
+func TestCoerceNumbers(t *testing.T) {
+	tests := []struct {
+		in  string
+		out float64
+		ok  bool
+	}{
+		{"42", 42, true},
+		{" -1.5e3 ", -1500, true},
+		{".5", 0.5, true},
+		{"010", 10, true},
+		{"0755", 755, true},
+		{"0x1F90", 8080, true},
+		{"-0X10", -16, true},
+		{"0b11", 0, false},
+		{"0o17", 0, false},
+		{"1_000", 0, false},
+		{"0x_10", 0, false},
+		{"0x1p4", 0, false},
+		{"inf", 0, false},
+		{"-Inf", 0, false},
+		{"NaN", 0, false},
+		{"+-1", 0, false},
+		{"", 0, false},
+	}
+
+	l := lua.NewState()
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			var out float64
+			err := ToGo(l, lua.LString(test.in), &out, Coerce())
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.out, out)
+		})
+	}
+}
+
+type arrayValues struct {
+	Position [3]float64 `lua:"position"`
+	Color    [3]uint8   `lua:"color"`
+}
+
+func TestArrays(t *testing.T) {
+	cases := []struct {
+		script   string
+		expected arrayValues
+		err      string
+		lenient  arrayValues
+	}{
+		{
+			script:   `return { position = { 1, 2.5, -3 }, color = { 255, 128, 0 } }`,
+			expected: arrayValues{Position: [3]float64{1, 2.5, -3}, Color: [3]uint8{255, 128, 0}},
+		},
+		{
+			script:  `return { position = { 1, 2 } }`,
+			err:     "position: length error: expected 3 elements, got 2",
+			lenient: arrayValues{Position: [3]float64{1, 2, 0}},
+		},
+		{
+			script:  `return { color = { 1, 2, 3, 4 } }`,
+			err:     "color: length error: expected 3 elements, got 4",
+			lenient: arrayValues{Position: [3]float64{9, 9, 9}, Color: [3]uint8{1, 2, 3}},
+		},
+		{
+			script: `return { color = { 1, 2, 256 } }`,
+			err:    "color[3]: number 256 overflows uint8",
+		},
+		{
+			script: `return { position = "origin" }`,
+			err:    "position: type error: expected table, got string",
+		},
+		{
+			script: `return { position = { 1, 2, 3, x = 4 } }`,
+			err:    "position.x: invalid key in array: x",
+		},
+		{
+			script:   `return { position = { 1, nil, 3 } }`,
+			expected: arrayValues{Position: [3]float64{1, 0, 3}},
+		},
+		{
+			script: `return {
+				position = setmetatable({ 1, 2 }, { __len = function() return 3 end, __index = function() return 7 end }),
+			}`,
+			err:     "position: length error: expected 3 elements, got 2",
+			lenient: arrayValues{Position: [3]float64{1, 2, 0}},
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			l := lua.NewState()
+			require.NoError(l.DoString(c.script))
+
+			var v arrayValues
+			err := ToGo(l, l.Get(-1), &v)
+			if c.err != "" {
+				assert.EqualError(err, c.err)
+			} else {
+				assert.NoError(err)
+				assert.Equal(c.expected, v)
+			}
+
+			if c.lenient != (arrayValues{}) {
+				v = arrayValues{Position: [3]float64{9, 9, 9}}
+				assert.NoError(ToGo(l, l.Get(-1), &v, LenientArrays()))
+				assert.Equal(c.lenient, v)
+			}
+		})
+	}
+}
+
+type cyclicNode struct {
+	Name     string        `lua:"name"`
+	Parent   *cyclicNode   `lua:"parent"`
+	Children []*cyclicNode `lua:"children"`
+}
+
+type flatNode struct {
+	Name     string     `lua:"name"`
+	Children []flatNode `lua:"children"`
+}
+
+func TestToGoCycles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	require.NoError(l.DoString(`
+		root = { name = "root" }
+		root.children = { { name = "a", parent = root }, { name = "b", parent = root } }
+		root.self = root
+	`))
+	root := l.GetGlobal("root")
+
+	// Pointers
+	var node *cyclicNode
+	require.NoError(ToGo(l, root, &node))
+	require.Len(node.Children, 2)
+	assert.Same(node, node.Children[0].Parent)
+	assert.Same(node, node.Children[1].Parent)
+	assert.Equal("b", node.Children[1].Name)
+
+	// Values cannot hold themselves
+	require.NoError(l.DoString(`loop = { name = "loop" }; loop.children = { loop }`))
+	var flat flatNode
+	assert.EqualError(ToGo(l, l.GetGlobal("loop"), &flat),
+		"children[1]: cycle detected: table contains itself and cannot be decoded to luax.flatNode")
+
+	// Any
+	var v any
+	require.NoError(ToGo(l, root, &v))
+	m, ok := v.(map[string]any)
+	require.True(ok)
+	assert.Equal(reflect.ValueOf(m).UnsafePointer(), reflect.ValueOf(m["self"]).UnsafePointer())
+	children, ok := m["children"].([]any)
+	require.True(ok)
+	parent := children[0].(map[string]any)["parent"]
+	assert.Equal(reflect.ValueOf(m).UnsafePointer(), reflect.ValueOf(parent).UnsafePointer())
+
+	// Maps
+	type selfMap map[string]selfMap
+	require.NoError(l.DoString(`m = {}; m.self = m`))
+	var sm selfMap
+	require.NoError(ToGo(l, l.GetGlobal("m"), &sm))
+	assert.Equal(reflect.ValueOf(sm).UnsafePointer(), reflect.ValueOf(sm["self"]).UnsafePointer())
+}
+
+func TestRecursiveType(t *testing.T) {
+	type selfMap map[string]selfMap
+	cases := []struct {
+		value     any
+		recursive bool
+	}{
+		{value: benchStruct{}, recursive: false},
+		{value: []map[string]int{}, recursive: false},
+		{value: struct{ Any any }{}, recursive: false},
+		{value: cyclicNode{}, recursive: true},
+		{value: &cyclicNode{}, recursive: true},
+		{value: flatNode{}, recursive: true},
+		{value: selfMap{}, recursive: true},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert.Equal(t, c.recursive, recursiveType(reflect.TypeOf(c.value)))
+		})
+	}
+}
+
+func TestToGoAny(t *testing.T) {
+	cases := []struct {
+		script   string
+		opts     []Option
+		expected any
+		err      string
+	}{
+		{script: `return { 1, 2, "three" }`, expected: []any{float64(1), float64(2), "three"}},
+		{script: `return { a = 1, b = true }`, expected: map[string]any{"a": float64(1), "b": true}},
+		{script: `return {}`, expected: map[string]any{}},
+		{script: `return {}`, opts: []Option{EmptyTables(EmptyTablesAsSlice)}, expected: []any{}},
+		{script: `return { 1, 2, 3 }`, opts: []Option{Int64Numbers()}, expected: []any{int64(1), int64(2), int64(3)}},
+		{script: `return { 1.5, 2^63 }`, opts: []Option{Int64Numbers()}, expected: []any{1.5, float64(1 << 63)}},
+		{
+			script:   `return { "a", "b", key = "value", [true] = 1 }`,
+			expected: map[any]any{float64(1): "a", float64(2): "b", "key": "value", true: float64(1)},
+		},
+		{
+			script:   `return { "a", key = "value" }`,
+			opts:     []Option{Int64Numbers()},
+			expected: map[any]any{int64(1): "a", "key": "value"},
+		},
+		{
+			script:   `return { "a", key = "value", [1.5] = "x" }`,
+			opts:     []Option{MixedTables(MixedTablesAsStringMap)},
+			expected: map[string]any{"1": "a", "key": "value", "1.5": "x"},
+		},
+		{script: `return { "a", nil, "c" }`, expected: []any{"a", nil, "c"}},
+		{script: `return { [2^40] = "x" }`, expected: map[any]any{float64(1 << 40): "x"}},
+		{
+			script:   `return { "a", [1000] = "x" }`,
+			opts:     []Option{MixedTables(MixedTablesAsStringMap)},
+			expected: map[string]any{"1": "a", "1000": "x"},
+		},
+		{
+			script: `return { [2^40] = "x" }`,
+			opts:   []Option{MixedTables(MixedTablesError)},
+			err:    "mixed table: expected either sequence or string keys",
+		},
+		{
+			script: `return { "a", [true] = "value" }`,
+			opts:   []Option{MixedTables(MixedTablesAsStringMap)},
+			err:    "mixed table: expected string or number keys",
+		},
+		{
+			script: `return { nested = { "a", key = "value" } }`,
+			opts:   []Option{MixedTables(MixedTablesError)},
+			err:    "mixed table: expected either sequence or string keys",
+		},
+		{
+			script: `return { f = print }`,
+			err:    "unsupported type function",
+		},
+		{
+			script: `return { [{ 1, 2 }] = "list", key = "value" }`,
+			err:    "invalid key: []interface {} is not comparable",
+		},
+		{
+			script: `return { [{ a = 1 }] = true }`,
+			opts:   []Option{CollectErrors()},
+			err:    "invalid key: map[string]interface {} is not comparable",
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			l := lua.NewState()
+			require.NoError(l.DoString(c.script))
+
+			var v any
+			err := ToGo(l, l.Get(-1), &v, c.opts...)
+			if c.err != "" {
+				assert.EqualError(err, c.err)
+			} else {
+				assert.NoError(err)
+				assert.Equal(c.expected, v)
+			}
+		})
+	}
+}
+
+func TestSparseArrays(t *testing.T) {
+	cases := []struct {
+		script   string
+		opts     []Option
+		expected []string
+		err      string
+	}{
+		{script: `return { "a", "b" }`, expected: []string{"a", "b"}},
+		{script: `return {}`, expected: []string{}},
+		{script: `return { [3] = "c" }`, expected: []string{"", "", "c"}},
+		{script: `return { "a", nil, "c" }`, expected: []string{"a", "", "c"}},
+		{
+			script:   `return { "a", nil, "c", [6] = "f" }`,
+			opts:     []Option{SparseArrays(SparseArraysCompact)},
+			expected: []string{"a", "c", "f"},
+		},
+		{script: `return { "a", "b" }`, opts: []Option{SparseArrays(SparseArraysError)}, expected: []string{"a", "b"}},
+		{
+			script: `return { [5] = "x" }`,
+			opts:   []Option{SparseArrays(SparseArraysError)},
+			err:    "sparse array: 1 elements for indexes up to 5",
+		},
+		{
+			script: `return { [2^40] = "x" }`,
+			err:    "sparse array: 1 elements for indexes up to 1099511627776, too sparse to be allocated",
+		},
+		{script: `return { [2^40] = "x" }`, opts: []Option{SparseArrays(SparseArraysCompact)}, expected: []string{"x"}},
+		{script: `return { "a", [66] = "x" }`, expected: append(append([]string{"a"}, make([]string, 64)...), "x")},
+		{script: `return { "a", [1.5] = "b" }`, err: "[1.5]: invalid key in array: 1.5"},
+		{script: `return { [0] = "a" }`, err: "[0]: invalid key in array: 0"},
+		{script: `return { "a", key = "b" }`, err: "key: invalid key in array: key"},
+		{script: `return { "a", nil, 3 }`, err: "[3]: type error: expected string, got number"},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			l := lua.NewState()
+			require.NoError(l.DoString(c.script))
+
+			var v []string
+			err := ToGo(l, l.Get(-1), &v, c.opts...)
+			if c.err != "" {
+				assert.EqualError(err, c.err)
+			} else {
+				assert.NoError(err)
+				assert.Equal(c.expected, v)
+			}
+		})
+	}
+}
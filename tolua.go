@@ -3,6 +3,7 @@ package luax
 import (
 	"fmt"
 	"reflect"
+	"unsafe"
 
 	lua "github.com/yuin/gopher-lua"
 )
@@ -11,31 +12,117 @@ type LuaValuer interface {
 	LuaValue(*lua.LState) (lua.LValue, error)
 }
 
-func ToLua(l *lua.LState, v any) lua.LValue {
+// ToLua converts the Go value v to a Lua value, raising a Lua error if it cannot be converted.
+// opts are applied on top of the options of l.
+func ToLua(l *lua.LState, v any, opts ...Option) lua.LValue {
 	rv := reflect.ValueOf(v)
 	if !rv.IsValid() {
 		return lua.LNil
 	}
-	res, err := toLua(l, v, rv, rv.Type())
+	res, err := newEncoder(l, opts).toLua(v, rv, rv.Type())
 	if err != nil {
 		l.RaiseError(err.Error())
 	}
 	return res
 }
 
-func toLua(l *lua.LState, v any, rv reflect.Value, t reflect.Type) (lua.LValue, error) {
+// Push converts values to Lua values and pushes them onto the stack, raising a Lua error if one cannot be converted.
+func Push(l *lua.LState, values ...any) {
+	for _, v := range values {
+		l.Push(ToLua(l, v))
+	}
+}
+
+// encoder holds the state of a conversion from Go to Lua.
+type encoder struct {
+	l    *lua.LState
+	opts *options
+	// visiting are the references being converted, used to detect cycles
+	visiting map[ref]bool
+	// tables are the tables converted from references, when references are preserved
+	tables map[ref]*lua.LTable
+	// detached is set when converting outside of the goroutine running l, in which case the registered types are
+	// looked up in types, resolved beforehand, and values requiring l cannot be converted
+	detached bool
+	types    map[reflect.Type]*goTypeDescriptor
+}
+
+// ref identifies a Go value which can be reached several times in a graph of values: a pointer, a map, a non-empty
+// slice, or an addressable struct.
+// A pointer to a struct and the struct it points to share the same ref.
+type ref struct {
+	t   reflect.Type
+	ptr unsafe.Pointer
+	len int
+}
+
+func refOf(rv reflect.Value) (ref, bool) {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map:
+		if !rv.IsNil() {
+			return ref{t: rv.Type(), ptr: rv.UnsafePointer()}, true
+		}
+	case reflect.Slice:
+		if rv.Len() > 0 {
+			return ref{t: rv.Type(), ptr: rv.UnsafePointer(), len: rv.Len()}, true
+		}
+	case reflect.Struct:
+		if rv.CanAddr() {
+			return refOf(rv.Addr())
+		}
+	}
+	return ref{}, false
+}
+
+func newEncoder(l *lua.LState, opts []Option) *encoder {
+	return &encoder{
+		l:    l,
+		opts: optionsOf(l, opts),
+	}
+}
+
+func (e *encoder) toLua(v any, rv reflect.Value, t reflect.Type) (lua.LValue, error) {
 	if v, ok := v.(LuaValuer); ok {
-		return v.LuaValue(l)
+		if e.detached {
+			return lua.LNil, errDetached(t)
+		}
+		return v.LuaValue(e.l)
 	}
 
 	// Find if there's a Lua type for this Go type
-	if goType := getGoType(l, t); goType != nil && goType.metatable != lua.LNil {
-		ud := l.NewUserData()
+	if goType := e.goType(t); goType != nil && goType.metatable != lua.LNil {
+		ud := e.l.NewUserData()
 		ud.Metatable = goType.metatable
 		ud.Value = v
 		return ud, nil
 	}
 
+	if res, ok := scalarToLua(rv); ok {
+		return res, nil
+	}
+
+	if res, ok, err := textToLua(rv); ok {
+		return res, err
+	}
+
+	r, isRef := refOf(rv)
+	if isRef {
+		if table, ok := e.tables[r]; ok {
+			return table, nil
+		}
+		// A pointer to a struct is tracked by the struct it points to
+		if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+			if e.visiting[r] {
+				return lua.LNil, fmt.Errorf("cycle detected at %v", t)
+			}
+			if e.visiting == nil {
+				e.visiting = make(map[ref]bool)
+			}
+			e.visiting[r] = true
+			defer delete(e.visiting, r)
+		}
+	}
+
 	switch rv.Kind() {
 	case reflect.String:
 		return lua.LString(rv.String()), nil
@@ -48,8 +135,8 @@ func toLua(l *lua.LState, v any, rv reflect.Value, t reflect.Type) (lua.LValue,
 	case reflect.Bool:
 		return lua.LBool(rv.Bool()), nil
 	case reflect.Struct:
-		table := l.NewTable()
-		if err := structToLua(l, table, rv, t); err != nil {
+		table := e.newTable(r, isRef)
+		if err := e.structToLua(table, rv, t); err != nil {
 			return lua.LNil, err
 		}
 		return table, nil
@@ -58,16 +145,16 @@ func toLua(l *lua.LState, v any, rv reflect.Value, t reflect.Type) (lua.LValue,
 			return lua.LNil, nil
 		}
 
-		table := l.NewTable()
+		table := e.newTable(r, isRef)
 		iter := rv.MapRange()
 		for iter.Next() {
 			key := iter.Key()
 			value := iter.Value()
-			luaKey, err := toLua(l, key.Interface(), key, key.Type())
+			luaKey, err := e.toLua(key.Interface(), key, key.Type())
 			if err != nil {
 				return lua.LNil, err
 			}
-			luaValue, err := toLua(l, value.Interface(), value, value.Type())
+			luaValue, err := e.toLua(value.Interface(), value, value.Type())
 			if err != nil {
 				return lua.LNil, err
 			}
@@ -78,13 +165,17 @@ func toLua(l *lua.LState, v any, rv reflect.Value, t reflect.Type) (lua.LValue,
 		if rv.IsNil() {
 			return lua.LNil, nil
 		}
-		fallthrough
-	case reflect.Array:
-		table := l.NewTable()
-		if err := numericKeysToLua(l, table, rv); err != nil {
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte slices are strings
+			return lua.LString(rv.Bytes()), nil
+		}
+		table := e.newTable(r, isRef)
+		if err := e.numericKeysToLua(table, rv); err != nil {
 			return lua.LNil, err
 		}
 		return table, nil
+	case reflect.Array:
+		return e.sequenceToLua(rv)
 	case reflect.Pointer, reflect.Interface:
 		// Handle nil pointer/interface
 		if rv.IsZero() {
@@ -92,48 +183,105 @@ func toLua(l *lua.LState, v any, rv reflect.Value, t reflect.Type) (lua.LValue,
 		}
 
 		elem := rv.Elem()
-		return toLua(l, elem.Interface(), elem, elem.Type())
+		return e.toLua(elem.Interface(), elem, elem.Type())
+	case reflect.Chan:
+		if rv.IsNil() {
+			return lua.LNil, nil
+		}
+		if e.detached {
+			return lua.LNil, errDetached(t)
+		}
+		return e.chanToLua(rv), nil
+	case reflect.Func:
+		if rv.IsNil() {
+			return lua.LNil, nil
+		}
+		if e.detached {
+			return lua.LNil, errDetached(t)
+		}
+		f, err := newGoFunction(v)
+		if err != nil {
+			return lua.LNil, err
+		}
+		return e.l.NewFunction(f), nil
 	default:
 		return lua.LNil, fmt.Errorf("unsupported kind: %v", rv.Kind())
 	}
 }
 
-func structToLua(l *lua.LState, target *lua.LTable, rv reflect.Value, t reflect.Type) error {
-	for i := 0; i < rv.NumField(); i++ {
-		field := t.Field(i)
-		if field.IsExported() {
-			tag := luaStructTagOf(field)
-			switch {
-			case tag.NumericKeys:
-				if err := numericKeysToLua(l, target, rv.Field(i)); err != nil {
-					return err
-				}
-			case tag.Inline:
-				field := rv.Field(i)
-				if field.Kind() != reflect.Struct {
-					return fmt.Errorf("field %s: inline is only allowed on structs", t.Field(i).Name)
-				}
-				if err := structToLua(l, target, field, t.Field(i).Type); err != nil {
-					return err
-				}
-			case !tag.Ignore:
-				field := rv.Field(i)
-
-				fieldValue, err := toLua(l, field.Interface(), field, field.Type())
-				if err != nil {
-					return fmt.Errorf("field %s: %w", t.Field(i).Name, err)
-				}
-				target.RawSet(lua.LString(tag.FieldName), fieldValue)
+// goType returns the registered type of t, or nil if t is not registered.
+func (e *encoder) goType(t reflect.Type) *goTypeDescriptor {
+	if e.detached {
+		return e.types[t]
+	}
+	return getGoType(e.l, t)
+}
+
+// newTable returns a new table for the Go value identified by r, recording it if references are preserved.
+func (e *encoder) newTable(r ref, isRef bool) *lua.LTable {
+	table := e.l.NewTable()
+	if isRef && e.opts.preserveReferences {
+		if e.tables == nil {
+			e.tables = make(map[ref]*lua.LTable)
+		}
+		e.tables[r] = table
+	}
+	return table
+}
+
+func (e *encoder) structToLua(target *lua.LTable, rv reflect.Value, t reflect.Type) error {
+	info := cachedStructInfo(t, e.opts.naming, false)
+	if info.err != nil {
+		return info.err
+	}
+	for _, f := range info.fields {
+		field := fieldByIndex(rv, f.index, false)
+		if !field.IsValid() {
+			// Embedded nil pointer
+			continue
+		}
+
+		if f.tag.NumericKeys {
+			if err := e.numericKeysToLua(target, field); err != nil {
+				return err
 			}
+			continue
+		}
+
+		if f.tag.OmitEmpty && field.IsZero() {
+			continue
 		}
+
+		var (
+			fieldValue lua.LValue
+			err        error
+		)
+		if f.tag.Array && field.Kind() == reflect.Slice && !field.IsNil() {
+			fieldValue, err = e.sequenceToLua(field)
+		} else {
+			fieldValue, err = e.toLua(field.Interface(), field, field.Type())
+		}
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.tag.FieldName, err)
+		}
+		target.RawSet(lua.LString(f.tag.FieldName), fieldValue)
 	}
 	return nil
 }
 
-func numericKeysToLua(l *lua.LState, table *lua.LTable, rv reflect.Value) error {
+// sequenceToLua converts the slice or array rv to a sequence table.
+func (e *encoder) sequenceToLua(rv reflect.Value) (lua.LValue, error) {
+	table := e.l.NewTable()
+	if err := e.numericKeysToLua(table, rv); err != nil {
+		return lua.LNil, err
+	}
+	return table, nil
+}
+
+func (e *encoder) numericKeysToLua(table *lua.LTable, rv reflect.Value) error {
 	for i := 0; i < rv.Len(); i++ {
 		item := rv.Index(i)
-		itemValue, err := toLua(l, item.Interface(), item, item.Type())
+		itemValue, err := e.toLua(item.Interface(), item, item.Type())
 		if err != nil {
 			return fmt.Errorf("item %d: %w", i, err)
 		}
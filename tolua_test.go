@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -85,3 +86,131 @@ func TestToLua(t *testing.T) {
 		})
 	}
 }
+
+type benchStruct struct {
+	ID       int               `lua:"id"`
+	Name     string            `lua:"name"`
+	Email    string            `lua:"email"`
+	Age      int               `lua:"age"`
+	Score    float64           `lua:"score"`
+	Active   bool              `lua:"active"`
+	Tags     []string          `lua:"tags"`
+	Metadata map[string]string `lua:"metadata"`
+	Address  struct {
+		Street string `lua:"street"`
+		City   string `lua:"city"`
+	} `lua:"address"`
+	Ignored string `lua:"-"`
+}
+
+func newBenchStruct() *benchStruct {
+	s := &benchStruct{
+		ID:       42,
+		Name:     "Chuck",
+		Email:    "chuck@example.com",
+		Age:      80,
+		Score:    13.37,
+		Active:   true,
+		Tags:     []string{"a", "b"},
+		Metadata: map[string]string{"k": "v"},
+	}
+	s.Address.Street = "Main street"
+	s.Address.City = "Springfield"
+	return s
+}
+
+func BenchmarkToLuaStruct(b *testing.B) {
+	l := lua.NewState()
+	s := newBenchStruct()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ToLua(l, s)
+	}
+}
+
+type bytesValues struct {
+	Hash  []byte `lua:"hash"`
+	Raw   []byte `lua:"raw,array"`
+	Empty []byte `lua:"empty"`
+}
+
+func TestByteSlices(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	value := ToLua(l, bytesValues{
+		Hash: []byte{0xde, 0xad, 0xbe, 0xef},
+		Raw:  []byte{1, 2},
+	})
+	require.IsType(&lua.LTable{}, value)
+	table := value.(*lua.LTable)
+	assert.Equal(lua.LString("\xde\xad\xbe\xef"), table.RawGetString("hash"))
+	assert.Equal(lua.LNil, table.RawGetString("empty"))
+	if raw, ok := table.RawGetString("raw").(*lua.LTable); assert.True(ok) {
+		assert.Equal(2, raw.Len())
+		assert.Equal(lua.LNumber(2), raw.RawGetInt(2))
+	}
+
+	var decoded bytesValues
+	require.NoError(ToGo(l, value, &decoded))
+	assert.Equal([]byte{0xde, 0xad, 0xbe, 0xef}, decoded.Hash)
+	assert.Equal([]byte{1, 2}, decoded.Raw)
+	assert.Nil(decoded.Empty)
+
+	require.NoError(l.DoString(`return { hash = "abc", raw = "de" }`))
+	decoded = bytesValues{}
+	require.NoError(ToGo(l, l.Get(-1), &decoded))
+	assert.Equal([]byte("abc"), decoded.Hash)
+	assert.Equal([]byte("de"), decoded.Raw)
+}
+
+type treeNode struct {
+	Name     string      `lua:"name"`
+	Parent   *treeNode   `lua:"parent"`
+	Children []*treeNode `lua:"children"`
+}
+
+func TestToLuaReferences(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+	root := &treeNode{Name: "root"}
+	root.Children = []*treeNode{{Name: "a", Parent: root}, {Name: "b", Parent: root}}
+
+	// Cycles are an error by default
+	l.SetGlobal("tolua", l.NewFunction(func(l *lua.LState) int {
+		l.Push(ToLua(l, root))
+		return 1
+	}))
+	err := l.DoString(`tolua()`)
+	require.Error(err)
+	assert.Contains(err.Error(), "field children: item 0: field parent: cycle detected at luax.treeNode")
+
+	// Shared references are converted once
+	l.SetGlobal("root", ToLua(l, root, PreserveReferences()))
+	require.NoError(l.DoString(`
+		assert(root.children[1].parent == root)
+		assert(root.children[2].parent == root)
+		assert(root.children[1].name == "a")
+	`))
+
+	// Values shared without cycles are copied by default
+	shared := &treeNode{Name: "shared"}
+	pair := []*treeNode{shared, shared}
+	l.SetGlobal("copied", ToLua(l, pair))
+	l.SetGlobal("preserved", ToLua(l, pair, PreserveReferences()))
+	require.NoError(l.DoString(`
+		assert(copied[1] ~= copied[2])
+		assert(copied[1].name == copied[2].name)
+		assert(preserved[1] == preserved[2])
+	`))
+
+	// Self-referencing maps
+	m := map[string]any{}
+	m["self"] = m
+	l.SetGlobal("m", ToLua(l, m, PreserveReferences()))
+	require.NoError(l.DoString(`assert(m.self == m)`))
+}
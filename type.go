@@ -16,7 +16,7 @@ type LuaNewIndexer interface {
 }
 
 // newIndexFunc returns the __index function
-// It first calls delegate, and if no value is returned, looks into the metatable
+// It first calls delegate, and if no value is returned, looks for a method (see findMethod)
 func newIndexFunc(delegate lua.LGFunction) lua.LGFunction {
 	return func(l *lua.LState) int {
 		res := delegate(l)
@@ -24,10 +24,10 @@ func newIndexFunc(delegate lua.LGFunction) lua.LGFunction {
 			return res
 		}
 
-		mt, mtOk := l.GetMetatable(l.Get(1)).(*lua.LTable)
+		ud, udOk := l.Get(1).(*lua.LUserData)
 		field, fieldOk := l.Get(2).(lua.LString)
-		if mtOk && fieldOk {
-			f := mt.RawGet(field)
+		if udOk && fieldOk {
+			f := findMethod(l, ud, string(field))
 			if f != lua.LNil {
 				l.Push(f)
 				return 1
@@ -40,33 +40,170 @@ func newIndexFunc(delegate lua.LGFunction) lua.LGFunction {
 	}
 }
 
+// findMethod looks up the method name of ud.
+// The metatable of ud is searched first, then the metatables of its parent types, and finally the metatables of the
+// types of its embedded fields (and their parents).
+// Methods found on another type are bound to the matching embedded value if there is one.
+func findMethod(l *lua.LState, ud *lua.LUserData, name string) lua.LValue {
+	if mt, ok := ud.Metatable.(*lua.LTable); ok {
+		if f := mt.RawGetString(name); f != lua.LNil {
+			return f
+		}
+	}
+
+	v := reflect.ValueOf(ud.Value)
+	if !v.IsValid() {
+		return lua.LNil
+	}
+	if goType := getGoType(l, v.Type()); goType != nil {
+		for parent := goType.parent; parent != nil; parent = parent.parent {
+			if f := parent.metatable.RawGetString(name); f != lua.LNil {
+				if recv, ok := embeddedReceiver(v, parent.goType); ok {
+					return bindReceiver(l, ud, f, recv)
+				}
+				return f
+			}
+		}
+	}
+
+	for _, recv := range embeddedValues(v) {
+		for goType := getGoType(l, recv.Type()); goType != nil; goType = goType.parent {
+			if f := goType.metatable.RawGetString(name); f != lua.LNil {
+				return bindReceiver(l, ud, f, recv)
+			}
+		}
+	}
+	return lua.LNil
+}
+
+// embeddedValues returns the values of the embedded fields of the struct (or pointer to struct) v, shallowest first.
+// Addressable non-pointer fields are returned as pointers.
+func embeddedValues(v reflect.Value) []reflect.Value {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var res []reflect.Value
+	for _, f := range cachedStructInfo(v.Type(), fieldNaming{}, true).embedded {
+		field := fieldByIndex(v, f.index, false)
+		if !field.IsValid() || !field.CanInterface() {
+			continue
+		}
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				continue
+			}
+		} else if field.CanAddr() {
+			field = field.Addr()
+		}
+		res = append(res, field)
+	}
+	return res
+}
+
+// embeddedReceiver returns the value of type t embedded in v.
+func embeddedReceiver(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	if v.Type().AssignableTo(t) {
+		return reflect.Value{}, false
+	}
+	for _, field := range embeddedValues(v) {
+		if recv, err := receiverOf(field.Interface(), t); err == nil {
+			return recv, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// bindReceiver returns a function calling f with recv as receiver when called on ud.
+func bindReceiver(l *lua.LState, ud *lua.LUserData, f lua.LValue, recv reflect.Value) lua.LValue {
+	fn, ok := f.(*lua.LFunction)
+	if !ok {
+		return f
+	}
+	return l.NewFunction(func(l *lua.LState) int {
+		if l.Get(1) == ud {
+			l.Replace(1, NewUserData(l, recv.Interface()))
+		}
+		l.Insert(fn, 1)
+		l.Call(l.GetTop()-1, lua.MultRet)
+		return l.GetTop()
+	})
+}
+
 func indexLuaIndexer(l *lua.LState) int {
 	userData := l.CheckUserData(1)
 	return userData.Value.(LuaIndexer).LuaIndex(l, 2)
 }
 
-func indexStruct(l *lua.LState) int {
-	// TODO: Handle numeric keys
-	userData := l.CheckUserData(1)
-	index := l.CheckString(2)
+// lookupField returns the field of the struct (or pointer to struct) v named name in Lua, along with its tag.
+// If alloc is true, nil embedded pointers are allocated.
+func (gt *goTypeDescriptor) lookupField(v reflect.Value, name string, alloc bool) (reflect.Value, luaStructTag, bool) {
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if f := gt.structInfo(v.Type()).byName[name]; f != nil {
+		field := fieldByIndex(v, f.index, alloc)
+		return field, f.tag, field.IsValid()
+	}
+	return reflect.Value{}, luaStructTag{}, false
+}
 
-	v := reflect.ValueOf(userData.Value)
+// numericKeysField returns the field of the struct (or pointer to struct) v tagged with numkeys.
+func (gt *goTypeDescriptor) numericKeysField(v reflect.Value, alloc bool) (reflect.Value, bool) {
 	if v.Kind() == reflect.Pointer {
 		v = v.Elem()
 	}
-	vType := v.Type()
-	for i := 0; i < v.NumField(); i++ {
-		if vType.Field(i).IsExported() {
-			field := v.Field(i)
-			tag := luaStructTagOf(vType.Field(i))
-			if tag.FieldName != "" && index == tag.FieldName {
-				l.Push(ToLua(l, field.Interface()))
+	if f := gt.structInfo(v.Type()).numericKeys; f != nil {
+		field := fieldByIndex(v, f.index, alloc)
+		return field, field.IsValid()
+	}
+	return reflect.Value{}, false
+}
+
+// addrOf returns a pointer to v if v is addressable, or v otherwise.
+func addrOf(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v.Addr()
+	}
+	return v
+}
+
+// indexStruct returns the __index function of the struct type (or pointer to struct type) gt.
+func indexStruct(gt *goTypeDescriptor) lua.LGFunction {
+	return func(l *lua.LState) int {
+		userData := l.CheckUserData(1)
+		v := reflect.ValueOf(userData.Value)
+
+		if key, ok := l.Get(2).(lua.LNumber); ok {
+			if field, ok := gt.numericKeysField(v, false); ok {
+				l.Push(indexValue(l, field, key))
 				return 1
 			}
+			return 0
 		}
-	}
 
-	return 0
+		index := l.CheckString(2)
+		if field, tag, ok := gt.lookupField(v, index, false); ok {
+			if tag.Proxy {
+				proxy, err := NewProxy(l, addrOf(field).Interface())
+				if err != nil {
+					l.RaiseError("field %s: %v", index, err)
+				}
+				l.Push(proxy)
+			} else {
+				l.Push(gt.fieldToLua(l, field))
+			}
+			return 1
+		}
+
+		return 0
+	}
 }
 
 func newIndexLuaNewIndexer(l *lua.LState) int {
@@ -75,29 +212,33 @@ func newIndexLuaNewIndexer(l *lua.LState) int {
 	return 0
 }
 
-func newIndexStruct(l *lua.LState) int {
-	// TODO: Handle numeric keys
-	userData := l.CheckUserData(1)
-	index := l.CheckString(2)
-	value := l.Get(3)
+// newIndexStruct returns the __newindex function of the struct type (or pointer to struct type) gt.
+func newIndexStruct(gt *goTypeDescriptor) lua.LGFunction {
+	return func(l *lua.LState) int {
+		userData := l.CheckUserData(1)
+		v := reflect.ValueOf(userData.Value)
+		value := l.Get(3)
 
-	v := reflect.ValueOf(userData.Value)
-	if v.Kind() == reflect.Pointer {
-		v = v.Elem()
-	}
-	vType := v.Type()
-	for i := 0; i < v.NumField(); i++ {
-		if vType.Field(i).IsExported() {
-			field := v.Field(i)
-			tag := luaStructTagOf(vType.Field(i))
-			if tag.FieldName != "" && index == tag.FieldName {
-				if err := toGo(l, value, field); err != nil {
+		if key, ok := l.Get(2).(lua.LNumber); ok {
+			if field, ok := gt.numericKeysField(v, true); ok {
+				if err := newIndexValue(l, addrOf(field), key, value); err != nil {
 					l.RaiseError(err.Error())
 				}
 			}
+			return 0
 		}
+
+		index := l.CheckString(2)
+		if field, tag, ok := gt.lookupField(v, index, true); ok {
+			if tag.ReadOnly {
+				l.RaiseError("field %s is read-only", index)
+			}
+			if err := (&decoder{l: l, opts: gt.opts}).decode(value, field); err != nil {
+				l.RaiseError(err.Error())
+			}
+		}
+		return 0
 	}
-	return 0
 }
 
 func CheckUserData[T any](l *lua.LState, n int) T {
@@ -149,36 +290,68 @@ func LuaMethod[T any](name string, f func(T, *lua.LState) int) Method {
 	}
 }
 
-func GoMethod(name string, f any) Method {
+// GoMethod returns a Method calling the Go function f, which must take the receiver as its first argument
+// (method expressions such as (*T).Method are suitable).
+// Lua arguments are converted to the types of the remaining parameters, and results are converted back using ToLua.
+// If the last result of f is an error, a non-nil value raises a Lua error (see ReturnErrors for an alternative).
+func GoMethod(name string, f any, opts ...FuncOption) Method {
 	return func() (string, lua.LGFunction, error) {
 		rf := reflect.ValueOf(f)
-		t := rf.Type()
-		if t.Kind() != reflect.Func {
+		if rf.Kind() != reflect.Func {
 			return name, nil, fmt.Errorf("invalid type: expected function")
 		}
-		if t.NumIn() == 0 {
+		t := rf.Type()
+		if t.NumIn() == 0 || (t.NumIn() == 1 && t.IsVariadic()) {
 			return name, nil, fmt.Errorf("invalid function type: missing receiver arg")
 		}
+		o := newFuncOptions(opts)
 
 		return name, func(l *lua.LState) int {
-			args := make([]reflect.Value, t.NumIn())
-
 			// First arg must be receiver
-			args[0] = reflect.ValueOf(l.CheckUserData(1).Value)
-
-			// Get following args
-			for i := 1; i < t.NumIn(); i++ {
-				// TODO
+			recv, err := receiverOf(l.CheckUserData(1).Value, t.In(0))
+			if err != nil {
+				l.ArgError(1, err.Error())
 			}
 
-			// TODO
-			return 0
+			// Following args are mapped to the remaining parameters
+			args := goArgs(l, t, 1, 2)
+			args[0] = recv
+
+			return callGo(l, rf, args, o)
 		}, nil
 	}
 }
 
 type goTypeDescriptor struct {
+	goType    reflect.Type
 	metatable *lua.LTable
+	parent    *goTypeDescriptor
+	// opts are the options of the state when the type was registered, used to convert its fields
+	opts *options
+	// fields is the plan of the struct type (or pointer to struct type) goType, or nil for other types
+	fields *structInfo
+}
+
+// structInfo returns the plan of the struct type t, with the field naming of gt.
+func (gt *goTypeDescriptor) structInfo(t reflect.Type) *structInfo {
+	if gt.fields != nil && (t == gt.goType || gt.goType.Kind() == reflect.Pointer && t == gt.goType.Elem()) {
+		return gt.fields
+	}
+	return cachedStructInfo(t, gt.opts.naming, true)
+}
+
+// fieldToLua converts the struct field v to a Lua value, using the options of gt.
+func (gt *goTypeDescriptor) fieldToLua(l *lua.LState, v reflect.Value) lua.LValue {
+	value := v.Interface()
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		return lua.LNil
+	}
+	res, err := (&encoder{l: l, opts: gt.opts}).toLua(value, rv, rv.Type())
+	if err != nil {
+		l.RaiseError(err.Error())
+	}
+	return res
 }
 
 func getGoType(l *lua.LState, t reflect.Type) *goTypeDescriptor {
@@ -210,28 +383,98 @@ func getGoTypesMap(l *lua.LState) map[reflect.Type]*goTypeDescriptor {
 	return t.(*lua.LUserData).Value.(map[reflect.Type]*goTypeDescriptor)
 }
 
+// TypeOption is an option of RegisterTypeWithOptions.
+// Method values are type options exposing a single method.
+type TypeOption interface {
+	applyType(c *typeConfig) error
+}
+
+type typeConfig struct {
+	l      *lua.LState
+	goType reflect.Type
+	funcs  map[string]lua.LGFunction
+	parent *goTypeDescriptor
+}
+
+type typeOptionFunc func(c *typeConfig) error
+
+func (f typeOptionFunc) applyType(c *typeConfig) error {
+	return f(c)
+}
+
+func (m Method) applyType(c *typeConfig) error {
+	name, f, err := m()
+	if err != nil {
+		return fmt.Errorf("failed to register method %s: %w", name, err)
+	}
+	c.funcs[name] = f
+	return nil
+}
+
+// Parent makes the registered type inherit the methods of the type registered under name, which must already be
+// registered.
+// The metatable of the parent is chained using __index, and inherited methods are called with the embedded value of
+// the parent type as receiver when there is one.
+func Parent(name string) TypeOption {
+	return typeOptionFunc(func(c *typeConfig) error {
+		mt, ok := c.l.GetTypeMetatable(name).(*lua.LTable)
+		if ok {
+			for _, goType := range getGoTypesMap(c.l) {
+				if goType.metatable == mt {
+					c.parent = goType
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("unknown parent type %s", name)
+	})
+}
+
 // RegisterType register a new Go type in l.
 // The type is registered under name.
 // v must be a value of the source type (usually the zero value), and methods the methods to expose in Lua.
+// The fields of struct types are converted using the options of l at registration (see SetOptions).
 func RegisterType(l *lua.LState, name string, v any, methods ...Method) {
+	opts := make([]TypeOption, len(methods))
+	for i, m := range methods {
+		opts[i] = m
+	}
+	RegisterTypeWithOptions(l, name, v, opts...)
+}
+
+// RegisterTypeWithOptions is like RegisterType, but accepts any type option (e.g. AllMethods or Parent) in addition
+// to methods.
+func RegisterTypeWithOptions(l *lua.LState, name string, v any, opts ...TypeOption) {
 	goType := reflect.TypeOf(v)
 
 	mt := l.NewTypeMetatable(name)
 
-	// Register the global Go type
-	setGoType(l, goType, &goTypeDescriptor{
-		metatable: mt,
-	})
-
-	funcs := make(map[string]lua.LGFunction)
+	c := typeConfig{
+		l:      l,
+		goType: goType,
+		funcs:  make(map[string]lua.LGFunction),
+	}
 
 	// Add methods
-	for _, method := range methods {
-		name, f, err := method()
-		if err != nil {
-			panic(fmt.Errorf("failed to register method %s: %w", name, err))
+	for _, opt := range opts {
+		if err := opt.applyType(&c); err != nil {
+			panic(err)
 		}
-		funcs[name] = f
+	}
+	funcs := c.funcs
+
+	// Register the global Go type
+	gt := &goTypeDescriptor{
+		goType:    goType,
+		metatable: mt,
+		parent:    c.parent,
+		opts:      optionsOf(l, nil),
+	}
+	setGoType(l, goType, gt)
+	if c.parent != nil {
+		chain := l.NewTable()
+		chain.RawSetString("__index", c.parent.metatable)
+		l.SetMetatable(mt, chain)
 	}
 
 	// We need to get the underlying type if this is a pointer
@@ -239,18 +482,25 @@ func RegisterType(l *lua.LState, name string, v any, methods ...Method) {
 		goType = goType.Elem()
 	}
 
+	if goType.Kind() == reflect.Struct {
+		// Resolve the fields once, as they are looked up on every index
+		gt.fields = cachedStructInfo(goType, gt.opts.naming, true)
+	}
+
 	// Find operations
 	if _, ok := v.(LuaIndexer); ok {
 		funcs["__index"] = newIndexFunc(indexLuaIndexer)
 	} else if goType.Kind() == reflect.Struct {
-		funcs["__index"] = newIndexFunc(indexStruct)
+		funcs["__index"] = newIndexFunc(indexStruct(gt))
 	}
 
 	if _, ok := v.(LuaNewIndexer); ok {
 		funcs["__newindex"] = newIndexLuaNewIndexer
 	} else if goType.Kind() == reflect.Struct {
-		funcs["__newindex"] = newIndexStruct
+		funcs["__newindex"] = newIndexStruct(gt)
 	}
 
+	addMetamethods(v, funcs)
+
 	l.SetFuncs(mt, funcs)
 }
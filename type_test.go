@@ -1,10 +1,13 @@
 package luax
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -199,3 +202,199 @@ func TestInterface(t *testing.T) {
 	i2 := l.Get(2).(*lua.LUserData).Value.(I)
 	assert.Equal("=> 42", i2.Do())
 }
+
+func (p *Person) Greet(greeting string, punctuation ...string) string {
+	return greeting + ", " + p.FirstName + strings.Join(punctuation, "")
+}
+
+func (p *Person) Rename(firstName string) error {
+	if firstName == "" {
+		return errors.New("empty first name")
+	}
+	p.FirstName = firstName
+	return nil
+}
+
+func TestGoMethod(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+
+	RegisterType(l, "person", (*Person)(nil),
+		GoMethod("greet", (*Person).Greet),
+		GoMethod("rename", (*Person).Rename),
+	)
+	p := &Person{
+		FirstName: "Chuck",
+		LastName:  "Norris",
+	}
+	l.SetGlobal("chuck", ToLua(l, p))
+	if err := l.DoString(`
+		chuck:rename("Bob")
+		return chuck:greet("Hello", "!", "!")`); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(lua.LString("Hello, Bob!!"), l.Get(1))
+	assert.Equal("Bob", p.FirstName)
+
+	err := l.DoString(`chuck:rename("")`)
+	assert.ErrorContains(err, "empty first name")
+
+	err = l.DoString(`chuck:greet(42)`)
+	assert.ErrorContains(err, "bad argument #2")
+}
+
+type Animal struct {
+	Name string `lua:"name"`
+}
+
+func (a *Animal) luaDescribe(l *lua.LState) int {
+	l.Push(lua.LString("animal " + a.Name))
+	return 1
+}
+
+type Dog struct {
+	Animal
+	Breed string `lua:"breed"`
+}
+
+type Cat struct {
+	*Animal
+	Name string `lua:"name"`
+}
+
+func TestEmbeddedStruct(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	RegisterType(l, "animal", (*Animal)(nil),
+		LuaMethod("describe", (*Animal).luaDescribe),
+	)
+	RegisterType(l, "dog", (*Dog)(nil))
+	RegisterType(l, "cat", (*Cat)(nil))
+
+	dog := &Dog{Animal: Animal{Name: "Rex"}, Breed: "Corgi"}
+	cat := &Cat{Animal: &Animal{Name: "Embedded"}, Name: "Felix"}
+	l.SetGlobal("dog", ToLua(l, dog))
+	l.SetGlobal("cat", ToLua(l, cat))
+	if err := l.DoString(`
+		dog.name = "Max"
+		return dog.name, dog.breed, dog:describe(), cat.name, cat:describe()`); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(lua.LString("Max"), l.Get(1))
+	assert.Equal(lua.LString("Corgi"), l.Get(2))
+	assert.Equal(lua.LString("animal Max"), l.Get(3))
+	assert.Equal(lua.LString("Felix"), l.Get(4))
+	assert.Equal(lua.LString("animal Embedded"), l.Get(5))
+	assert.Equal("Max", dog.Name)
+}
+
+type Meta struct {
+	ID int `lua:"id"`
+}
+
+type embeddedMeta struct {
+	Meta
+	Name string `lua:"name"`
+}
+
+type inlineMeta struct {
+	Meta `lua:",inline"`
+	Name string `lua:"name"`
+}
+
+func TestEmbeddedStructConversion(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := lua.NewState()
+
+	// Embedded structs are converted as regular fields
+	table := ToLua(l, embeddedMeta{Meta: Meta{ID: 1}, Name: "x"}).(*lua.LTable)
+	assert.Equal(lua.LNil, table.RawGetString("id"))
+	if meta, ok := table.RawGetString("Meta").(*lua.LTable); assert.True(ok) {
+		assert.Equal(lua.LNumber(1), meta.RawGetString("id"))
+	}
+	var embedded embeddedMeta
+	require.NoError(ToGo(l, table, &embedded))
+	assert.Equal(embeddedMeta{Meta: Meta{ID: 1}, Name: "x"}, embedded)
+
+	// Inline structs are flattened
+	table = ToLua(l, inlineMeta{Meta: Meta{ID: 2}, Name: "y"}).(*lua.LTable)
+	assert.Equal(lua.LNumber(2), table.RawGetString("id"))
+	assert.Equal(lua.LNil, table.RawGetString("Meta"))
+	var inline inlineMeta
+	require.NoError(ToGo(l, table, &inline))
+	assert.Equal(inlineMeta{Meta: Meta{ID: 2}, Name: "y"}, inline)
+
+	// Inline is only allowed on structs
+	type invalidInline struct {
+		X int `lua:"x,inline"`
+	}
+	l.SetGlobal("tolua", l.NewFunction(func(l *lua.LState) int {
+		l.Push(ToLua(l, invalidInline{}))
+		return 1
+	}))
+	err := l.DoString(`tolua()`)
+	require.Error(err)
+	assert.Contains(err.Error(), "field X: inline is only allowed on structs")
+	assert.EqualError(ToGo(l, l.NewTable(), &invalidInline{}), "field X: inline is only allowed on structs")
+}
+
+type Shape interface {
+	Area() float64
+}
+
+type Square struct {
+	Side float64 `lua:"side"`
+}
+
+func (s *Square) Area() float64 {
+	return s.Side * s.Side
+}
+
+func TestParent(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lua.NewState()
+	RegisterType(l, "shape", (*Shape)(nil),
+		LuaMethod("area", func(s Shape, l *lua.LState) int {
+			l.Push(lua.LNumber(s.Area()))
+			return 1
+		}),
+	)
+	RegisterTypeWithOptions(l, "square", (*Square)(nil), Parent("shape"))
+
+	l.SetGlobal("sq", ToLua(l, &Square{Side: 3}))
+	if err := l.DoString(`return sq:area(), sq.side, getmetatable(sq).area ~= nil`); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(lua.LNumber(9), l.Get(1))
+	assert.Equal(lua.LNumber(3), l.Get(2))
+	assert.Equal(lua.LTrue, l.Get(3))
+
+	assert.Panics(func() {
+		RegisterTypeWithOptions(l, "circle", (*Square)(nil), Parent("unknown"))
+	})
+}
+
+func BenchmarkIndexStruct(b *testing.B) {
+	l := lua.NewState()
+	RegisterType(l, "bench", (*benchStruct)(nil))
+	l.SetGlobal("s", ToLua(l, newBenchStruct()))
+	fn, err := l.LoadString(`
+		local s = s
+		for i = 1, 100 do
+			s.score = s.score + s.age
+		end`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Push(fn)
+		l.Call(0, 0)
+	}
+}